@@ -12,6 +12,7 @@ load(
     "msbuild_binary_macro",
     "msbuild_library_macro",
     "msbuild_test_macro",
+    _msbuild_solution = "msbuild_solution",
 )
 load("@rules_msbuild//dotnet/private/rules:directory.bzl", _msbuild_directory = "msbuild_directory")
 load(
@@ -27,6 +28,7 @@ msbuild_directory = _msbuild_directory
 msbuild_binary = msbuild_binary_macro
 msbuild_library = msbuild_library_macro
 msbuild_test = msbuild_test_macro
+msbuild_solution = _msbuild_solution
 
 # nuget
 nuget_fetch = _nuget_fetch
@@ -24,10 +24,11 @@ def build_assembly(ctx, dotnet):
 
     protos = _getProtos(ctx)
 
-    inputs = depset(
-        [cache_manifest, ctx.file.project_file] + ctx.files.srcs + ctx.files.content,
+    public_inputs = depset(
+        [cache_manifest, ctx.file.project_file] + ctx.files.srcs + ctx.files.content + ctx.files.resources + ctx.files.references,
         transitive = files + [restore.files] + protos,
     )
+    inputs = depset(transitive = [public_inputs, restore.private_files])
 
     outputs = [
         output_dir,
@@ -53,7 +54,7 @@ def build_assembly(ctx, dotnet):
     info = DotnetLibraryInfo(
         assembly = assembly,
         output_dir = output_dir,
-        files = depset(direct = outputs, transitive = [inputs]),
+        files = depset(direct = outputs, transitive = [public_inputs]),
         caches = cache_set([cache], transitive = [caches]),
         runfiles = depset(ctx.files.data, transitive = runfiles),
         project_cache = cache.project,
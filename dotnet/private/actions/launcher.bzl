@@ -24,12 +24,16 @@ def make_launcher(ctx, dotnet, info):
         "dotnet_cmd": "exec",
         "dotnet_logger": "junit",
         "log_path_arg_name": "LogFilePath",
+        "coverage_collector": "XPlat Code Coverage",
     }
 
     is_test = getattr(dotnet.config, "is_test", False)
     if is_test:
         launch_data = dicts.add(launch_data, {
             "dotnet_cmd": ctx.attr.dotnet_cmd,
+            "dotnet_logger": ctx.attr.dotnet_logger,
+            "log_path_arg_name": ctx.attr.log_path_arg_name,
+            "coverage_collector": ctx.attr.coverage_collector,
         })
     extra_env = getattr(ctx.attr, "test_env", {})
 
@@ -13,10 +13,17 @@ def restore(ctx, dotnet):
     cache_manifest = write_cache_manifest(ctx, cache, cache_set(transitive = caches))
     directory_info = ctx.attr.msbuild_directory[MSBuildDirectoryInfo]
 
-    inputs = depset(
+    # private packages are restored for this project, but they don't flow to its consumers
+    private_files = []
+    for dep in getattr(ctx.attr, "private_deps", []):
+        get_nuget_files(dep, dotnet.config.tfm, private_files)
+    private_files = depset(transitive = private_files)
+
+    public_inputs = depset(
         direct = [ctx.file.project_file, cache_manifest],
         transitive = files + [directory_info.files],
     )
+    inputs = depset(transitive = [public_inputs, private_files])
 
     outputs.extend([cache.result, cache.project])
 
@@ -45,7 +52,8 @@ def restore(ctx, dotnet):
         target_framework = ctx.attr.target_framework,
         assets_json = assets_json,
         outputs = outputs,
-        files = depset(outputs, transitive = [inputs]),
+        files = depset(outputs, transitive = [public_inputs]),
+        private_files = private_files,
         caches = cache_set([cache], transitive = caches),
         directory_info = directory_info,
         assembly_name = assembly_name,
@@ -23,6 +23,30 @@ def msbuild_project(
         **kwargs
     )
 
+def msbuild_solution(
+        name,
+        srcs = [],
+        deps = [],
+        configurations = [],
+        visibility = ["//visibility:public"],
+        **kwargs):
+    """Groups the projects of a Visual Studio solution file.
+
+    Args:
+        name: the name of the target, the base name of the solution file by default
+        srcs: the solution file
+        deps: the projects in the solution
+        configurations: the solution configurations i.e. `Debug|Any CPU`, for documentation only
+        visibility: the visibility of the target
+        **kwargs: additional arguments for the filegroup
+    """
+    native.filegroup(
+        name = name,
+        srcs = srcs + deps,
+        visibility = visibility,
+        **kwargs
+    )
+
 def msbuild_binary_macro(
         name,
         args = [],
@@ -37,7 +61,7 @@ def msbuild_library_macro(
 def msbuild_test_macro(
         name,
         **kwargs):
-    test_args = _steal_args({}, kwargs, ["size", "dotnet_cmd", "test_env"])
+    test_args = _steal_args({}, kwargs, ["size", "shard_count", "dotnet_cmd", "test_env", "dotnet_logger", "log_path_arg_name", "coverage_collector"])
 
     _msbuild_assembly(name, msbuild_test, kwargs, test_args)
 
@@ -52,12 +76,27 @@ def _msbuild_assembly(
         assembly_impl,
         kwargs,
         assembly_args):
-    _steal_args(assembly_args, kwargs, ["data", "content", "protos"])
+    _steal_args(assembly_args, kwargs, ["data", "content", "resources", "protos", "references"])
 
     srcs, project_file = _guess_inputs(name, kwargs)
 
     deps = kwargs.pop("deps", [])
+    private_deps = kwargs.pop("private_deps", [])
     target_framework = kwargs.pop("target_framework", None)
+
+    # the outputs of a project are declared per package, so only one framework of a multi-targeting project can be built.
+    # Gazelle sets target_framework to the first one of target_frameworks, a rule that lists several frameworks without
+    # choosing one is ambiguous.
+    target_frameworks = kwargs.pop("target_frameworks", [])
+    if target_framework == None and target_frameworks:
+        if len(target_frameworks) > 1:
+            fail(("Target //{}:{} targets multiple frameworks ({}), building more than one framework of a project is " +
+                  "not supported. Set `target_framework = \"<tfm>\",  # keep` to choose the framework to build.").format(
+                native.package_name(),
+                name,
+                ", ".join(target_frameworks),
+            ))
+        target_framework = target_frameworks[0]
     restore_deps = []
     for d in deps:
         l = Label(d)
@@ -80,6 +119,7 @@ def _msbuild_assembly(
         msbuild_directory = msbuild_directory,
         project_file = project_file,
         deps = restore_deps,
+        private_deps = private_deps,
         **dicts.add(kwargs, dict(
             version = version,
             package_version = package_version,
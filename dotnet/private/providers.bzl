@@ -15,6 +15,7 @@ DotnetRestoreInfo = provider(
         "assets_json": "",
         "target_framework": "",
         "files": "",
+        "private_files": "depset of the files of private_deps, they aren't in files so they don't flow to consumers",
         "caches": "depset of DotentCacheInfo",
         "directory_info": "MSBuildDirectoryInfo",
         "assembly_name": "assembly_name",
@@ -46,6 +46,14 @@ def _restore_impl(ctx):
         ),
     ]
 
+def _instrumented_files_info(ctx):
+    # the sources of the assembly and its deps are reported by `bazel coverage`
+    return coverage_common.instrumented_files_info(
+        ctx,
+        source_attributes = ["srcs"],
+        dependency_attributes = ["deps"],
+    )
+
 def _binary_impl(ctx):
     return _make_executable(ctx, False)
 
@@ -73,6 +81,7 @@ def _make_executable(ctx, is_test):
             runfiles = assembly_runfiles,
             executable = launcher,
         ),
+        _instrumented_files_info(ctx),
         info,
         OutputGroupInfo(
             all = outputs,
@@ -87,6 +96,7 @@ def _library_impl(ctx):
             files = depset([info.assembly]),
             runfiles = ctx.runfiles(transitive_files = info.runfiles),
         ),
+        _instrumented_files_info(ctx),
         info,
         OutputGroupInfo(
             all = outputs,
@@ -205,6 +215,13 @@ This specifies Directory.Build.props and Directory.Build.targets to allow you to
         [DotnetRestoreInfo],
         [NuGetPackageInfo],
     ]),
+    "private_deps": attr.label_list(
+        doc = """NuGet packages that are only used to build this assembly, they don't flow to its consumers.
+
+Gazelle sets this attribute for `PackageReference`s with `PrivateAssets="all"` and for packages without compile
+assets, i.e. analyzers and SourceLink.""",
+        providers = [NuGetPackageInfo],
+    ),
     "version": attr.string(),
     "package_version": attr.string(),
 })
@@ -267,6 +284,22 @@ XML in the project file as usual.
 """,
         allow_files = True,
     ),
+    "resources": attr.label_list(
+        doc = """List of files that MSBuild embeds in the assembly.
+
+Corresponds to the `EmbeddedResource` Item type specified in a project file, i.e. `.resx` files. Like `content`, this
+attribute only includes the files as inputs for the bazel action, the project file decides how they are embedded.
+""",
+        allow_files = True,
+    ),
+    "references": attr.label_list(
+        doc = """Assemblies referenced by path with the `HintPath` of a `Reference` item in the project file.
+
+Gazelle sets this attribute for legacy (non-SDK) projects. Assemblies in another package must be exported by that
+package, i.e. with `exports_files`.
+""",
+        allow_files = [".dll", ".exe"],
+    ),
     "protos": attr.label_list(
         doc = """List of `proto_library` targets that this assembly depends on.
 
@@ -319,6 +352,30 @@ msbuild_test = rule(
     attrs = dicts.add(_EXECUTABLE_ATTRS, {
         "dotnet_cmd": attr.string(default = "test"),
         "test_env": attr.string_dict(),
+        "dotnet_logger": attr.string(
+            default = "junit",
+            doc = """The `dotnet test` logger that writes the test results.
+
+The default junit logger writes them to `XML_OUTPUT_FILE`. Other loggers write `test.<logger>` to the undeclared outputs
+of the test and bazel generates the xml. Gazelle sets this attribute for test frameworks that can't use the default
+junit logger, i.e. TUnit.""",
+        ),
+        "log_path_arg_name": attr.string(
+            default = "LogFilePath",
+            doc = "The parameter of `dotnet_logger` for the path of the results file.",
+        ),
+        "coverage_collector": attr.string(
+            default = "XPlat Code Coverage",
+            doc = """The `dotnet test --collect` data collector that measures coverage under `bazel coverage`.
+
+The default is [coverlet](https://github.com/coverlet-coverage/coverlet), the test project has to reference the
+`coverlet.collector` package. The launcher converts the Cobertura or OpenCover report of the collector to lcov.""",
+        ),
+        "_lcov_merger": attr.label(
+            default = "@bazel_tools//tools/test:lcov_merger",
+            executable = True,
+            cfg = "target",
+        ),
     }),
     executable = True,
     test = True,
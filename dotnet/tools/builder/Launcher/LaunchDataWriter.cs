@@ -1,52 +1,88 @@
 using System;
 using System.Collections.Generic;
 using System.IO;
+using System.Linq;
 using System.Text;
 
 namespace RulesMSBuild.Tools.Builder.Launcher
 {
+    /// <summary>
+    /// Appends launch data to a launcher in the versioned format of
+    /// //dotnet/tools/launcher/launchdata, see launchdata.go for the layout.
+    /// </summary>
     public class LaunchDataWriter : IDisposable
     {
+        public const ushort Version = 2;
+        private const string HeaderMagic = "MSBLDHDR";
+        private const string FooterMagic = "MSBLDEND";
+        private const byte KindString = 0;
+        private const byte KindList = 1;
+
+        private static readonly uint[] CrcTable = MakeCrcTable();
+
         private readonly Stream _stream;
-        private List<(string, string)> _data;
+        private readonly Dictionary<string, string> _values;
+        private readonly Dictionary<string, List<string>> _lists;
 
         public LaunchDataWriter(Stream stream)
         {
             _stream = stream;
-            _data = new List<(string, string)>();
+            _values = new Dictionary<string, string>();
+            _lists = new Dictionary<string, List<string>>();
         }
 
         public LaunchDataWriter Add(string key, string value)
         {
-            _data.Add((key,value));
+            _lists.Remove(key);
+            _values[key] = value;
+            return this;
+        }
+
+        public LaunchDataWriter AddList(string key, IEnumerable<string> values)
+        {
+            _values.Remove(key);
+            _lists[key] = values.ToList();
             return this;
         }
 
         public void Save()
         {
-            var launchDataStart = _stream.Position;
+            using var payload = new MemoryStream();
+            var writer = new BinaryWriter(payload, Encoding.UTF8);
 
-            // see @bazel_tools//src/tools/launcher/util/data_parser.cc
-            // a single key-value pair is stored as single set of non-null bytes
-            // the '{key}=' segment is read into a single-byte `char` (ascii)
-            // the '{value}' segment is read into a two-byte "wide char" `wchar_t`
-            // https://docs.microsoft.com/en-us/cpp/cpp/char-wchar-t-char16-t-char32-t?view=msvc-160
-            // https://stackoverflow.com/a/402918/2524934
-            var encoding = Encoding.UTF8;
+            writer.Write(Encoding.ASCII.GetBytes(HeaderMagic));
+            writer.Write(Version);
 
-            foreach (var (key, value) in _data)
+            // keys are sorted so launchers are reproducible
+            var keys = _values.Keys.Concat(_lists.Keys).OrderBy(k => k, StringComparer.Ordinal).ToList();
+            writer.Write((uint) keys.Count);
+            foreach (var key in keys)
             {
-                var builder = new StringBuilder(key.Length + 2 + value.Length)
-                    .Append(key)
-                    .Append('=')
-                    .Append(value)
-                    .Append('\0');
-
-                _stream.Write(encoding.GetBytes(builder.ToString()));
+                if (_lists.TryGetValue(key, out var list))
+                {
+                    writer.Write(KindList);
+                    WriteString(writer, key);
+                    writer.Write((uint) list.Count);
+                    foreach (var value in list)
+                        WriteString(writer, value);
+                }
+                else
+                {
+                    writer.Write(KindString);
+                    WriteString(writer, key);
+                    WriteString(writer, _values[key]);
+                }
             }
 
-            Int64 launchDataLength = _stream.Position - launchDataStart;
-            _stream.Write(BitConverter.GetBytes(launchDataLength));
+            writer.Flush();
+            writer.Write(Crc32(payload.GetBuffer(), (int) payload.Length));
+            writer.Flush();
+            // the length of everything from the header magic through the checksum
+            writer.Write((ulong) payload.Length);
+            writer.Write(Encoding.ASCII.GetBytes(FooterMagic));
+            writer.Flush();
+
+            payload.WriteTo(_stream);
             _stream.Flush();
         }
 
@@ -54,5 +90,36 @@ namespace RulesMSBuild.Tools.Builder.Launcher
         {
             _stream.Dispose();
         }
+
+        // BinaryWriter.Write(string) uses a 7-bit encoded length, the launcher reads a uint32
+        private static void WriteString(BinaryWriter writer, string value)
+        {
+            var bytes = Encoding.UTF8.GetBytes(value);
+            writer.Write((uint) bytes.Length);
+            writer.Write(bytes);
+        }
+
+        // CRC-32 (IEEE), the checksum of Go's hash/crc32.ChecksumIEEE
+        private static uint Crc32(byte[] buffer, int length)
+        {
+            var crc = 0xFFFFFFFFu;
+            for (var i = 0; i < length; i++)
+                crc = CrcTable[(crc ^ buffer[i]) & 0xFF] ^ (crc >> 8);
+            return ~crc;
+        }
+
+        private static uint[] MakeCrcTable()
+        {
+            var table = new uint[256];
+            for (uint i = 0; i < table.Length; i++)
+            {
+                var crc = i;
+                for (var j = 0; j < 8; j++)
+                    crc = (crc & 1) != 0 ? 0xEDB88320u ^ (crc >> 1) : crc >> 1;
+                table[i] = crc;
+            }
+
+            return table;
+        }
     }
-}
\ No newline at end of file
+}
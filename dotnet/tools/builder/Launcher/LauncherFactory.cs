@@ -1,4 +1,5 @@
 using System;
+using System.Collections.Generic;
 using System.IO;
 
 namespace RulesMSBuild.Tools.Builder.Launcher
@@ -8,6 +9,10 @@ namespace RulesMSBuild.Tools.Builder.Launcher
     /// </summary>
     public class LauncherFactory
     {
+        // the rules pass lists as a single argument joined by ListSeparator
+        private const string ListSeparator = "*~*";
+        private static readonly HashSet<string> ListKeys = new() { "dotnet_args", "assembly_args" };
+
         public int Create(string[] args)
         {
             using var writer = CreateWriter(args[0], args[1]);
@@ -15,7 +20,14 @@ namespace RulesMSBuild.Tools.Builder.Launcher
             writer.Add("binary_type", "Dotnet");
             for (int i = 2; i + 1 < args.Length; i += 2)
             {
-                writer.Add(args[i], args[i + 1]);
+                var (key, value) = (args[i], args[i + 1]);
+                if (ListKeys.Contains(key))
+                {
+                    writer.AddList(key, value == "" ? Array.Empty<string>() : value.Split(ListSeparator));
+                    continue;
+                }
+
+                writer.Add(key, value);
             }
 
             writer.Save();
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Environment variables bazel sets for `bazel coverage`
+const (
+	coverageDir        = "COVERAGE_DIR"
+	coverageOutputFile = "COVERAGE_OUTPUT_FILE"
+	// testUndeclaredOutputsDir is zipped into test.outputs/outputs.zip after the test
+	testUndeclaredOutputsDir = "TEST_UNDECLARED_OUTPUTS_DIR"
+)
+
+// lcovFileName is the name of the report in COVERAGE_DIR, bazel's coverage merger combines every .dat file in it
+const lcovFileName = "dotnet_coverage.dat"
+
+// coverage maps the workspace relative path of a source file to the hit count of each of its lines
+type coverage map[string]map[int]int
+
+// coverageConfig is set when the test runs under `bazel coverage`
+type coverageConfig struct {
+	dir        string
+	outputFile string
+}
+
+func getCoverageConfig() *coverageConfig {
+	dir := os.Getenv(coverageDir)
+	outputFile := os.Getenv(coverageOutputFile)
+	if dir == "" || outputFile == "" {
+		return nil
+	}
+	return &coverageConfig{dir: dir, outputFile: outputFile}
+}
+
+// resultsDirectory is where `dotnet test` writes its attachments, i.e. coverage reports. It is empty when bazel
+// doesn't collect any outputs, dotnet test then uses ./TestResults.
+func resultsDirectory(cov *coverageConfig) string {
+	if dir := os.Getenv(testUndeclaredOutputsDir); dir != "" {
+		return dir
+	}
+	if cov != nil {
+		return cov.dir
+	}
+	return ""
+}
+
+// writeLcov converts the coverage reports found in resultsDir to lcov for bazel
+func (c *coverageConfig) writeLcov(resultsDir string) error {
+	if resultsDir == "" {
+		resultsDir = "TestResults"
+	}
+	reports, err := findCoverageReports(resultsDir)
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 {
+		return fmt.Errorf("no coverage reports were found in %s, does the test project reference a coverage "+
+			"collector i.e. coverlet.collector?", resultsDir)
+	}
+	total := coverage{}
+	for _, report := range reports {
+		diag(func() { fmt.Printf("converting coverage report %s\n", report) })
+		data, err := ioutil.ReadFile(report)
+		if err != nil {
+			return err
+		}
+		cov, err := parseCoverage(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse coverage report %s: %w", report, err)
+		}
+		total.merge(cov)
+	}
+
+	var buf bytes.Buffer
+	total.writeLcov(&buf)
+	// the merger overwrites COVERAGE_OUTPUT_FILE with the .dat files of COVERAGE_DIR when it is configured, otherwise
+	// our report is the output
+	for _, p := range []string{filepath.Join(c.dir, lcovFileName), c.outputFile} {
+		if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findCoverageReports finds the Cobertura and OpenCover reports that coverlet writes, i.e.
+// TestResults/<guid>/coverage.cobertura.xml
+func findCoverageReports(dir string) ([]string, error) {
+	var reports []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name := strings.ToLower(info.Name())
+		if !info.IsDir() && (strings.HasSuffix(name, ".cobertura.xml") || strings.HasSuffix(name, ".opencover.xml")) {
+			reports = append(reports, p)
+		}
+		return nil
+	})
+	sort.Strings(reports)
+	return reports, err
+}
+
+type coberturaReport struct {
+	Sources []string         `xml:"sources>source"`
+	Classes []coberturaClass `xml:"packages>package>classes>class"`
+}
+
+type coberturaClass struct {
+	Filename string          `xml:"filename,attr"`
+	Lines    []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+type openCoverReport struct {
+	Modules []openCoverModule `xml:"Modules>Module"`
+}
+
+type openCoverModule struct {
+	Files   []openCoverFile  `xml:"Files>File"`
+	Methods []openCoverPoint `xml:"Classes>Class>Methods>Method>SequencePoints>SequencePoint"`
+}
+
+type openCoverFile struct {
+	Uid      string `xml:"uid,attr"`
+	FullPath string `xml:"fullPath,attr"`
+}
+
+type openCoverPoint struct {
+	Visits    int    `xml:"vc,attr"`
+	StartLine int    `xml:"sl,attr"`
+	FileId    string `xml:"fileid,attr"`
+}
+
+// parseCoverage parses a Cobertura or an OpenCover report depending on its root element
+func parseCoverage(data []byte) (coverage, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+	cov := coverage{}
+	switch root {
+	case "coverage":
+		var report coberturaReport
+		if err := xml.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		for _, class := range report.Classes {
+			filename := filepath.ToSlash(class.Filename)
+			if !path.IsAbs(filename) && len(report.Sources) > 0 {
+				filename = path.Join(filepath.ToSlash(report.Sources[0]), filename)
+			}
+			for _, line := range class.Lines {
+				cov.add(filename, line.Number, line.Hits)
+			}
+		}
+	case "CoverageSession":
+		var report openCoverReport
+		if err := xml.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		for _, module := range report.Modules {
+			files := map[string]string{}
+			for _, f := range module.Files {
+				files[f.Uid] = f.FullPath
+			}
+			for _, point := range module.Methods {
+				filename, exists := files[point.FileId]
+				if !exists || point.StartLine <= 0 {
+					continue
+				}
+				cov.add(filename, point.StartLine, point.Visits)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown coverage format with root element <%s>", root)
+	}
+	return cov, nil
+}
+
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", fmt.Errorf("no root element")
+		} else if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// add records the hits of a line, a line with several statements is as covered as its most covered statement
+func (c coverage) add(filename string, line, hits int) {
+	filename = workspacePath(filename)
+	lines, exists := c[filename]
+	if !exists {
+		lines = map[int]int{}
+		c[filename] = lines
+	}
+	if current, exists := lines[line]; !exists || hits > current {
+		lines[line] = hits
+	}
+}
+
+// merge keeps the most hits of each line of the reports, like the launcher script does: coverlet may write the same
+// run in several formats, adding them up would count it twice
+func (c coverage) merge(other coverage) {
+	for filename, lines := range other {
+		existing, exists := c[filename]
+		if !exists {
+			c[filename] = lines
+			continue
+		}
+		for line, hits := range lines {
+			if current, exists := existing[line]; !exists || hits > current {
+				existing[line] = hits
+			}
+		}
+	}
+}
+
+func (c coverage) writeLcov(w io.Writer) {
+	filenames := make([]string, 0, len(c))
+	for filename := range c {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		lines := c[filename]
+		numbers := make([]int, 0, len(lines))
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+
+		_, _ = fmt.Fprintf(w, "SF:%s\n", filename)
+		hit := 0
+		for _, line := range numbers {
+			if lines[line] > 0 {
+				hit++
+			}
+			_, _ = fmt.Fprintf(w, "DA:%d,%d\n", line, lines[line])
+		}
+		_, _ = fmt.Fprintf(w, "LH:%d\nLF:%d\nend_of_record\n", hit, len(numbers))
+	}
+}
+
+// workspacePath makes the path of a source file relative to the workspace. Assemblies are built with deterministic
+// source paths that replace the execroot with /_/, older builds and other tools report the path in the execroot.
+func workspacePath(p string) string {
+	p = filepath.ToSlash(p)
+	if strings.HasPrefix(p, "/_/") {
+		return p[len("/_/"):]
+	}
+	if i := strings.Index(p, "/execroot/"); i >= 0 {
+		rest := p[i+len("/execroot/"):]
+		if slash := strings.IndexRune(rest, '/'); slash >= 0 {
+			return rest[slash+1:]
+		}
+	}
+	return p
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+	"github.com/stretchr/testify/assert"
+)
+
+const coberturaXml = `<?xml version="1.0" encoding="utf-8"?>
+<coverage line-rate="0.75" branch-rate="1" version="1.9" timestamp="1633036800">
+  <sources>
+    <source>/_/</source>
+  </sources>
+  <packages>
+    <package name="Lib" line-rate="0.75">
+      <classes>
+        <class name="Lib.Math" filename="lib/Math.cs" line-rate="0.75">
+          <methods>
+            <method name="Add" signature="(System.Int32,System.Int32)">
+              <lines>
+                <line number="6" hits="2" branch="False" />
+              </lines>
+            </method>
+          </methods>
+          <lines>
+            <line number="6" hits="2" branch="False" />
+            <line number="7" hits="2" branch="False" />
+            <line number="10" hits="0" branch="False" />
+          </lines>
+        </class>
+        <class name="Lib.Math/Nested" filename="lib/Math.cs" line-rate="1">
+          <methods />
+          <lines>
+            <line number="14" hits="1" branch="False" />
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>`
+
+const openCoverXml = `<?xml version="1.0" encoding="utf-8"?>
+<CoverageSession>
+  <Modules>
+    <Module hash="1">
+      <Files>
+        <File uid="1" fullPath="/home/me/.cache/bazel/_bazel_me/123/execroot/my_workspace/lib/Strings.cs" />
+      </Files>
+      <Classes>
+        <Class>
+          <Methods>
+            <Method>
+              <SequencePoints>
+                <SequencePoint vc="3" uspid="1" ordinal="0" sl="5" sc="9" el="5" ec="10" fileid="1" />
+                <SequencePoint vc="1" uspid="2" ordinal="1" sl="5" sc="11" el="5" ec="30" fileid="1" />
+                <SequencePoint vc="0" uspid="3" ordinal="2" sl="8" sc="9" el="8" ec="10" fileid="1" />
+              </SequencePoints>
+            </Method>
+          </Methods>
+        </Class>
+      </Classes>
+    </Module>
+  </Modules>
+</CoverageSession>`
+
+func TestParseCobertura(t *testing.T) {
+	cov, err := parseCoverage([]byte(coberturaXml))
+	assert.NoError(t, err)
+	assert.Equal(t, coverage{
+		"lib/Math.cs": {6: 2, 7: 2, 10: 0, 14: 1},
+	}, cov)
+}
+
+func TestParseOpenCover(t *testing.T) {
+	cov, err := parseCoverage([]byte(openCoverXml))
+	assert.NoError(t, err)
+	assert.Equal(t, coverage{
+		"lib/Strings.cs": {5: 3, 8: 0},
+	}, cov)
+}
+
+func TestParseUnknownCoverage(t *testing.T) {
+	_, err := parseCoverage([]byte("<report />"))
+	assert.Error(t, err)
+}
+
+func TestWriteLcov(t *testing.T) {
+	cov := coverage{"lib/Math.cs": {7: 2, 6: 0, 8: 3}}
+	cov.merge(coverage{"lib/Math.cs": {6: 1, 8: 1, 9: 0}, "lib/Strings.cs": {1: 0}})
+
+	var buf bytes.Buffer
+	cov.writeLcov(&buf)
+	assert.Equal(t, `SF:lib/Math.cs
+DA:6,1
+DA:7,2
+DA:8,3
+DA:9,0
+LH:3
+LF:4
+end_of_record
+SF:lib/Strings.cs
+DA:1,0
+LH:0
+LF:1
+end_of_record
+`, buf.String())
+}
+
+func TestWriteLcovFromResults(t *testing.T) {
+	dir, err := ioutil.TempDir(bazel.TestTmpDir(), "coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	results := filepath.Join(dir, "results", "0f8fad5b-d9cb-469f-a165-70867728950e")
+	assert.NoError(t, os.MkdirAll(results, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(results, "coverage.cobertura.xml"), []byte(coberturaXml), 0644))
+
+	c := &coverageConfig{dir: dir, outputFile: filepath.Join(dir, "coverage.dat")}
+	assert.NoError(t, c.writeLcov(filepath.Join(dir, "results")))
+	for _, p := range []string{c.outputFile, filepath.Join(dir, lcovFileName)} {
+		data, err := ioutil.ReadFile(p)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "SF:lib/Math.cs\nDA:6,2\n")
+	}
+
+	assert.Error(t, c.writeLcov(filepath.Join(dir, "empty")))
+}
+
+func TestWorkspacePath(t *testing.T) {
+	assert.Equal(t, "lib/Math.cs", workspacePath("/_/lib/Math.cs"))
+	assert.Equal(t, "lib/Math.cs", workspacePath("/tmp/sandbox/linux-sandbox/1/execroot/ws/lib/Math.cs"))
+	assert.Equal(t, "lib/Math.cs", workspacePath("lib/Math.cs"))
+}
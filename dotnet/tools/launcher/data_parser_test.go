@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/bazelbuild/rules_go/go/tools/bazel"
+	"github.com/samhowes/rules_msbuild/dotnet/tools/launcher/launchdata"
 )
 
 func TestLauncher(t *testing.T) {
@@ -51,7 +52,43 @@ func TestLauncher(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if launchInfo.Data["foo"] != "bar" {
-		t.Errorf("Deserialized the wrong value for 'foo': %s", launchInfo.Data["foo"])
+	if foo, _ := launchInfo.GetItem("foo"); foo != "bar" {
+		t.Errorf("Deserialized the wrong value for 'foo': %s", foo)
+	}
+}
+
+func TestLauncherVersioned(t *testing.T) {
+	dataFile, err := ioutil.TempFile(bazel.TestTmpDir(), "launchData.*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dataFile.Name())
+
+	_, err = dataFile.WriteString("dont=readme\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := launchdata.New()
+	data.Set("foo", "bar=baz")
+	data.SetList("dotnet_args", []string{"--foo", "a*~*b"})
+	if err = launchdata.Write(dataFile, data); err != nil {
+		t.Fatal(err)
+	}
+	_ = dataFile.Close()
+
+	launchInfo, err := GetLaunchInfo(dataFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if foo, _ := launchInfo.GetItem("foo"); foo != "bar=baz" {
+		t.Errorf("Deserialized the wrong value for 'foo': %s", foo)
+	}
+	if args, _ := launchInfo.GetListItem("dotnet_args"); len(args) != 2 || args[1] != "a*~*b" {
+		t.Errorf("Deserialized the wrong value for 'dotnet_args': %v", args)
+	}
+	if _, err = launchInfo.GetItem("missing"); err == nil {
+		t.Errorf("expected an error for a missing key")
 	}
 }
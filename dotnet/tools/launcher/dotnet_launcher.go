@@ -28,46 +28,103 @@ func initDiag() {
 	ctx.debug = os.Getenv("DOTNET_LAUNCHER_DEBUG") != ""
 }
 
-func LaunchDotnet(args []string, info *LaunchInfo) {
-	dotnetEnv := info.GetItem("dotnet_env")
+func LaunchDotnet(args []string, info *LaunchInfo) error {
+	dotnetEnv, err := info.GetItem("dotnet_env")
+	if err != nil {
+		return err
+	}
 
 	for _, line := range strings.Split(dotnetEnv, ";") {
 		equals := strings.IndexRune(line, '=')
 		if equals <= 0 {
-			panic(fmt.Errorf("malformed dotnet environment line: %s", line))
+			return fmt.Errorf("malformed dotnet environment line: %s", line)
 		}
 		_ = os.Setenv(line[0:equals], line[equals+1:])
 	}
 
-	workspace := info.GetItem("workspace_name")
-	pkg := info.GetItem("package")
+	workspace, err := info.GetItem("workspace_name")
+	if err != nil {
+		return err
+	}
+	pkg, err := info.GetItem("package")
+	if err != nil {
+		return err
+	}
 	_ = os.Setenv("DOTNET_RUNFILES_WORKSPACE", workspace)
 	_ = os.Setenv("DOTNET_RUNFILES_PACKAGE", pkg)
 
-	dotnetBinPath := info.GetPathItem("dotnet_bin_path")
-	dotnetCmd := info.GetItem("dotnet_cmd")
-	dotnetArgs := append([]string{dotnetBinPath, dotnetCmd}, info.GetListItem("dotnet_args")...)
-	targetBinPath := info.GetBuiltPath("target_bin_path")
-	assemblyArgs := append([]string{targetBinPath}, info.GetListItem("assembly_args")...)
+	dotnetBinPath, err := info.GetPathItem("dotnet_bin_path")
+	if err != nil {
+		return err
+	}
+	dotnetCmd, err := info.GetItem("dotnet_cmd")
+	if err != nil {
+		return err
+	}
+	extraDotnetArgs, err := info.GetListItem("dotnet_args")
+	if err != nil {
+		return err
+	}
+	dotnetArgs := append([]string{dotnetBinPath, dotnetCmd}, extraDotnetArgs...)
+	targetBinPath, err := info.GetBuiltPath("target_bin_path")
+	if err != nil {
+		return err
+	}
+	extraAssemblyArgs, err := info.GetListItem("assembly_args")
+	if err != nil {
+		return err
+	}
+	assemblyArgs := append([]string{targetBinPath}, extraAssemblyArgs...)
 	assemblyArgs = append(assemblyArgs, args[1:]...)
 
+	var onExit func()
 	if dotnetCmd == "test" {
-		xmlFile := os.Getenv("XML_OUTPUT_FILE")
-		if xmlFile == "" {
-			xmlFile = "test.xml"
+		logger, err := info.GetItem("dotnet_logger")
+		if err != nil {
+			return err
 		}
-		loggerArg := fmt.Sprintf("%s;%s=%s",
-			info.GetItem("dotnet_logger"),
-			info.GetItem("log_path_arg_name"),
-			xmlFile,
-		)
+		logPathArgName, err := info.GetItem("log_path_arg_name")
+		if err != nil {
+			return err
+		}
+		loggerArg := fmt.Sprintf("%s;%s=%s", logger, logPathArgName, logFile(logger))
 		assemblyArgs = append(assemblyArgs, "--logger", loggerArg)
+
+		listArgs := append(dotnetArgs[:len(dotnetArgs):len(dotnetArgs)], targetBinPath)
+		filterArgs, skip, err := testArgs(listArgs)
+		if err != nil {
+			return err
+		}
+		if skip {
+			diag(func() { fmt.Printf("no tests to run in this shard\n") })
+			os.Exit(0)
+		}
+		assemblyArgs = append(assemblyArgs, filterArgs...)
+
+		cov := getCoverageConfig()
+		resultsDir := resultsDirectory(cov)
+		if resultsDir != "" {
+			assemblyArgs = append(assemblyArgs, "--results-directory", resultsDir)
+		}
+		if cov != nil {
+			collector, err := info.GetItem("coverage_collector")
+			if err != nil {
+				return err
+			}
+			assemblyArgs = append(assemblyArgs, "--collect", collector)
+			onExit = func() {
+				if err := cov.writeLcov(resultsDir); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "failed to write coverage report: %v\n", err)
+				}
+			}
+		}
 	}
 
 	newArgs := append(dotnetArgs, assemblyArgs...)
 
 	diag(func() { fmt.Printf("==> launching: \"%s\"\n", strings.Join(newArgs, "\" \"")) })
-	launch(info, newArgs)
+	launch(info, newArgs, onExit)
+	return nil
 }
 
 func LaunchDotnetPublish(args []string, info *LaunchInfo) {
@@ -94,11 +151,28 @@ func LaunchDotnetPublish(args []string, info *LaunchInfo) {
 		"exec",
 		assembly,
 	}, args[1:]...)
-	launch(info, newArgs)
+	launch(info, newArgs, nil)
 }
 
-func launch(info *LaunchInfo, args []string) {
-	launchMode, ok := info.Data["launch_mode"]
+// junitLogger writes the junit xml that bazel reads
+const junitLogger = "junit"
+
+// logFile is where the logger writes the test results. Bazel only reads junit xml from XML_OUTPUT_FILE, other reports,
+// i.e. trx, are written to the results directory by name so that they end up in the undeclared outputs and bazel
+// generates the xml.
+func logFile(logger string) string {
+	if logger != junitLogger {
+		return "test." + logger
+	}
+	if xmlFile := os.Getenv("XML_OUTPUT_FILE"); xmlFile != "" {
+		return xmlFile
+	}
+	return "test.xml"
+}
+
+// launch starts the command, onExit post-processes the results of the command when the launcher waits for it
+func launch(info *LaunchInfo, args []string, onExit func()) {
+	launchMode, ok := info.Data.Lookup("launch_mode")
 	if !ok {
 		launchMode = "wait"
 	}
@@ -125,6 +199,9 @@ func launch(info *LaunchInfo, args []string) {
 		}
 		diag(func() { fmt.Printf("cmd completed: %s\n", state.String()) })
 		code = state.ExitCode()
+		if onExit != nil {
+			onExit()
+		}
 		os.Exit(code)
 	} else {
 		if err := cmd.Process.Release(); err != nil {
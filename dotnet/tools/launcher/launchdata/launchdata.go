@@ -0,0 +1,135 @@
+// Package launchdata reads and writes the launch data that is appended to the launcher executable. The launcher reads
+// the data from the end of its own executable to find the assembly to launch and how to launch it.
+//
+// The current format (version 2) is laid out as follows, integers are little endian:
+//
+//	header magic    8 bytes  "MSBLDHDR"
+//	version         uint16
+//	field count     uint32
+//	fields          field count times:
+//	    kind        uint8    0 for a string, 1 for a list of strings
+//	    key         uint32 length, then the utf8 bytes of the key
+//	    value       a string: uint32 length, then its utf8 bytes
+//	                a list: uint32 count, then count strings
+//	checksum        uint32   CRC-32 (IEEE) of everything from the header magic up to the checksum
+//	length          uint64   the number of bytes from the header magic through the checksum
+//	footer magic    8 bytes  "MSBLDEND"
+//
+// The legacy format (version 1) is a sequence of `key=value\0` pairs followed by their uint64 length. Lists are
+// joined with LegacyListSeparator. The builder writes the current format, the reader still supports the legacy one so
+// that launchers that were built before keep working.
+package launchdata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// LegacyVersion is the `key=value\0` format
+	LegacyVersion = 1
+	// Version is the format written by Writer
+	Version = 2
+	// LegacyListSeparator joins the elements of a list in the legacy format
+	LegacyListSeparator = "*~*"
+)
+
+const (
+	headerMagic = "MSBLDHDR"
+	footerMagic = "MSBLDEND"
+	// footerSize is the length and the footer magic
+	footerSize = 8 + len(footerMagic)
+	// maxFieldLength guards against allocating huge buffers for corrupt data
+	maxFieldLength = 1 << 24
+)
+
+const (
+	kindString byte = iota
+	kindList
+)
+
+// Data is the launch data of a launcher
+type Data struct {
+	// Version is the format the data was read from
+	Version int
+	values  map[string]string
+	lists   map[string][]string
+}
+
+// New creates empty launch data in the current format
+func New() *Data {
+	return &Data{
+		Version: Version,
+		values:  map[string]string{},
+		lists:   map[string][]string{},
+	}
+}
+
+// Lookup returns a string value and whether it is present
+func (d *Data) Lookup(key string) (string, bool) {
+	value, present := d.values[key]
+	return value, present
+}
+
+// Get returns a required string value
+func (d *Data) Get(key string) (string, error) {
+	value, present := d.values[key]
+	if !present {
+		return "", fmt.Errorf("missing required launch data key: %s", key)
+	}
+	return value, nil
+}
+
+// GetList returns a required list. Lists in the legacy format are strings joined with LegacyListSeparator.
+func (d *Data) GetList(key string) ([]string, error) {
+	if list, present := d.lists[key]; present {
+		return list, nil
+	}
+	value, err := d.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return []string{}, nil
+	}
+	return strings.Split(value, LegacyListSeparator), nil
+}
+
+// Set sets a string value
+func (d *Data) Set(key, value string) {
+	delete(d.lists, key)
+	d.values[key] = value
+}
+
+// SetList sets a list value
+func (d *Data) SetList(key string, values []string) {
+	delete(d.values, key)
+	d.lists[key] = append([]string{}, values...)
+}
+
+// Keys returns the sorted keys of all the values
+func (d *Data) Keys() []string {
+	keys := make([]string, 0, len(d.values)+len(d.lists))
+	for k := range d.values {
+		keys = append(keys, k)
+	}
+	for k := range d.lists {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *Data) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "launch data v%d:", d.Version)
+	for _, k := range d.Keys() {
+		if list, present := d.lists[k]; present {
+			_, _ = fmt.Fprintf(&b, " %s=%q", k, list)
+		} else {
+			_, _ = fmt.Fprintf(&b, " %s=%q", k, d.values[k])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package launchdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+	"github.com/stretchr/testify/assert"
+)
+
+// launcher is the content of the launcher executable before the launch data
+const launcher = "MZ\x00\x00not=really\x00an executable"
+
+func testData() *Data {
+	d := New()
+	d.Set("binary_type", "Dotnet")
+	d.Set("dotnet_env", "DOTNET_CLI_HOME=/home/me;NUGET_PACKAGES=/nuget")
+	d.Set("weird=key", "value\x00with a null")
+	d.Set("empty", "")
+	d.SetList("dotnet_args", []string{"--no-build", "a*~*b"})
+	d.SetList("assembly_args", nil)
+	return d
+}
+
+func write(t *testing.T, d *Data) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(launcher)
+	assert.NoError(t, Write(&buf, d))
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := write(t, testData())
+
+	d, err := Read(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, Version, d.Version)
+	assert.Equal(t, testData().Keys(), d.Keys())
+
+	value, err := d.Get("weird=key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value\x00with a null", value)
+
+	list, err := d.GetList("dotnet_args")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--no-build", "a*~*b"}, list)
+
+	list, err = d.GetList("assembly_args")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = d.Get("missing")
+	assert.EqualError(t, err, "missing required launch data key: missing")
+	_, present := d.Lookup("missing")
+	assert.False(t, present)
+}
+
+func TestWriteIsReproducible(t *testing.T) {
+	assert.Equal(t, write(t, testData()), write(t, testData()))
+}
+
+func TestReadLegacy(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(launcher)
+	legacy := "binary_type=Dotnet\x00dotnet_env=A=B;C=D\x00dotnet_args=--no-build*~*--foo\x00assembly_args=\x00"
+	buf.WriteString(legacy)
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(legacy)))
+	buf.Write(length)
+
+	d, err := Read(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, LegacyVersion, d.Version)
+
+	value, err := d.Get("dotnet_env")
+	assert.NoError(t, err)
+	assert.Equal(t, "A=B;C=D", value)
+
+	list, err := d.GetList("dotnet_args")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--no-build", "--foo"}, list)
+
+	list, err = d.GetList("assembly_args")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestReadErrors(t *testing.T) {
+	data := write(t, testData())
+	payloadStart := len(launcher)
+
+	corrupt := func(f func(b []byte) []byte) error {
+		b := f(append([]byte{}, data...))
+		_, err := Read(bytes.NewReader(b))
+		return err
+	}
+
+	// a flipped bit in a value fails the checksum
+	err := corrupt(func(b []byte) []byte {
+		b[payloadStart+20] ^= 1
+		return b
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum")
+
+	// a length that runs past the beginning of the file
+	err = corrupt(func(b []byte) []byte {
+		binary.LittleEndian.PutUint64(b[len(b)-footerSize:], uint64(len(b)))
+		return b
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid launch data length")
+
+	// a legacy length that runs past the beginning of the file
+	_, err = Read(bytes.NewReader([]byte("abc=def\x00\xff\x00\x00\x00\x00\x00\x00\x00")))
+	assert.Error(t, err)
+
+	// too small to contain anything
+	_, err = Read(bytes.NewReader([]byte("abc")))
+	assert.Error(t, err)
+}
+
+func TestReadFutureVersion(t *testing.T) {
+	var body bytes.Buffer
+	body.WriteString(headerMagic)
+	putUint16(&body, Version+1)
+	putUint32(&body, 0)
+
+	d, err := parse(body.Bytes())
+	assert.Nil(t, d)
+	assert.EqualError(t, err, "unsupported launch data version 3, expected 2")
+}
+
+func TestCreateLauncher(t *testing.T) {
+	dir, err := ioutil.TempDir(bazel.TestTmpDir(), "launchdata")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "launcher.exe")
+	assert.NoError(t, ioutil.WriteFile(template, []byte(launcher), 0755))
+	output := filepath.Join(dir, "app.exe")
+
+	assert.NoError(t, CreateLauncher(template, output, testData()))
+
+	content, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, launcher, string(content[:len(launcher)]))
+
+	d, err := ReadFile(output)
+	assert.NoError(t, err)
+	value, err := d.Get("binary_type")
+	assert.NoError(t, err)
+	assert.Equal(t, "Dotnet", value)
+
+	assert.Error(t, CreateLauncher(filepath.Join(dir, "missing.exe"), output, testData()))
+}
@@ -0,0 +1,196 @@
+package launchdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// ReadFile reads the launch data from the end of the file at path
+func ReadFile(path string) (*Data, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads the launch data from the end of r in either the current or the legacy format
+func Read(r io.ReadSeeker) (*Data, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek in file: %w", err)
+	}
+	if size < 8 {
+		return nil, fmt.Errorf("file is too small to contain launch data: %d bytes", size)
+	}
+
+	tail := make([]byte, 8)
+	if err := readAt(r, size-8, tail); err != nil {
+		return nil, fmt.Errorf("failed to read launch data footer: %w", err)
+	}
+	if string(tail) == footerMagic {
+		return readCurrent(r, size)
+	}
+	return readLegacy(r, size, int64(binary.LittleEndian.Uint64(tail)))
+}
+
+func readAt(r io.ReadSeeker, offset int64, buf []byte) error {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, buf)
+	return err
+}
+
+func readCurrent(r io.ReadSeeker, size int64) (*Data, error) {
+	if size < int64(footerSize) {
+		return nil, fmt.Errorf("file is too small to contain launch data: %d bytes", size)
+	}
+	lengthBytes := make([]byte, 8)
+	if err := readAt(r, size-int64(footerSize), lengthBytes); err != nil {
+		return nil, fmt.Errorf("failed to read launch data length: %w", err)
+	}
+	length := binary.LittleEndian.Uint64(lengthBytes)
+	// the payload is at least the header magic, version, field count and checksum
+	minLength := uint64(len(headerMagic) + 2 + 4 + 4)
+	if length < minLength || length > uint64(size-int64(footerSize)) {
+		return nil, fmt.Errorf("invalid launch data length %d in a file of %d bytes", length, size)
+	}
+
+	payload := make([]byte, length)
+	if err := readAt(r, size-int64(footerSize)-int64(length), payload); err != nil {
+		return nil, fmt.Errorf("failed to read launch data: %w", err)
+	}
+
+	body := payload[:len(payload)-4]
+	checksum := binary.LittleEndian.Uint32(payload[len(payload)-4:])
+	if actual := crc32.ChecksumIEEE(body); actual != checksum {
+		return nil, fmt.Errorf("launch data is corrupt: checksum %08x does not match %08x", actual, checksum)
+	}
+	return parse(body)
+}
+
+// parse parses the payload without its checksum
+func parse(body []byte) (*Data, error) {
+	p := &parser{buf: body}
+	if magic := p.bytes(len(headerMagic)); p.err == nil && string(magic) != headerMagic {
+		return nil, fmt.Errorf("launch data is corrupt: bad header magic %q", magic)
+	}
+	version := int(p.uint16())
+	if p.err == nil && version != Version {
+		return nil, fmt.Errorf("unsupported launch data version %d, expected %d", version, Version)
+	}
+
+	d := New()
+	count := p.uint32()
+	for i := uint32(0); i < count && p.err == nil; i++ {
+		kind := p.byte()
+		key := p.string()
+		switch kind {
+		case kindString:
+			d.Set(key, p.string())
+		case kindList:
+			n := p.uint32()
+			if n > maxFieldLength {
+				return nil, fmt.Errorf("launch data is corrupt: list %s has %d elements", key, n)
+			}
+			list := make([]string, 0, n)
+			for j := uint32(0); j < n && p.err == nil; j++ {
+				list = append(list, p.string())
+			}
+			d.SetList(key, list)
+		default:
+			if p.err == nil {
+				return nil, fmt.Errorf("launch data is corrupt: unknown kind %d for key %s", kind, key)
+			}
+		}
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("launch data is corrupt: %w", p.err)
+	}
+	if p.pos != len(p.buf) {
+		return nil, fmt.Errorf("launch data is corrupt: %d unexpected bytes after the fields", len(p.buf)-p.pos)
+	}
+	return d, nil
+}
+
+// parser reads little endian values from a buffer, the first error stops parsing and is kept in err
+type parser struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (p *parser) bytes(n int) []byte {
+	if p.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(p.buf)-p.pos {
+		p.err = fmt.Errorf("unexpected end of data at offset %d reading %d bytes", p.pos, n)
+		return nil
+	}
+	b := p.buf[p.pos : p.pos+n]
+	p.pos += n
+	return b
+}
+
+func (p *parser) byte() byte {
+	if b := p.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (p *parser) uint16() uint16 {
+	if b := p.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (p *parser) uint32() uint32 {
+	if b := p.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (p *parser) string() string {
+	n := p.uint32()
+	if p.err == nil && n > maxFieldLength {
+		p.err = fmt.Errorf("field of %d bytes at offset %d is too long", n, p.pos)
+		return ""
+	}
+	return string(p.bytes(int(n)))
+}
+
+// readLegacy reads `key=value\0` pairs that precede the length at the end of the file
+func readLegacy(r io.ReadSeeker, size, length int64) (*Data, error) {
+	if length < 0 || length > size-8 {
+		return nil, fmt.Errorf("invalid launch data length %d in a file of %d bytes", length, size)
+	}
+	launchBytes := make([]byte, length)
+	if err := readAt(r, size-8-length, launchBytes); err != nil {
+		return nil, fmt.Errorf("failed to read launch data: %w", err)
+	}
+
+	d := New()
+	d.Version = LegacyVersion
+	for _, pair := range bytes.Split(launchBytes, []byte{0}) {
+		if len(pair) == 0 {
+			continue
+		}
+		// keys can't contain '=', values can
+		equals := bytes.IndexByte(pair, '=')
+		if equals <= 0 {
+			return nil, fmt.Errorf("malformed launch data entry %q", pair)
+		}
+		d.Set(string(pair[:equals]), string(pair[equals+1:]))
+	}
+	return d, nil
+}
@@ -0,0 +1,85 @@
+package launchdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Write appends the launch data to w in the current format. Keys are written in sorted order so launchers are
+// reproducible.
+func Write(w io.Writer, d *Data) error {
+	var buf bytes.Buffer
+	buf.WriteString(headerMagic)
+	putUint16(&buf, Version)
+	keys := d.Keys()
+	putUint32(&buf, uint32(len(keys)))
+	for _, k := range keys {
+		if list, present := d.lists[k]; present {
+			buf.WriteByte(kindList)
+			putString(&buf, k)
+			putUint32(&buf, uint32(len(list)))
+			for _, v := range list {
+				putString(&buf, v)
+			}
+		} else {
+			buf.WriteByte(kindString)
+			putString(&buf, k)
+			putString(&buf, d.values[k])
+		}
+	}
+	putUint32(&buf, crc32.ChecksumIEEE(buf.Bytes()))
+	length := uint64(buf.Len())
+
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint64(footer, length)
+	buf.Write(footer)
+	buf.WriteString(footerMagic)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// CreateLauncher copies the launcher template to outputPath and appends the launch data to it, like the launcher
+// command of the builder does.
+func CreateLauncher(templatePath, outputPath string, d *Data) error {
+	template, err := os.Open(templatePath)
+	if err != nil {
+		return fmt.Errorf("launcher template does not exist at %s: %w", templatePath, err)
+	}
+	defer template.Close()
+
+	output, err := os.OpenFile(outputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create launcher %s: %w", outputPath, err)
+	}
+	if _, err := io.Copy(output, template); err != nil {
+		_ = output.Close()
+		return fmt.Errorf("failed to copy launcher template to %s: %w", outputPath, err)
+	}
+	if err := Write(output, d); err != nil {
+		_ = output.Close()
+		return fmt.Errorf("failed to write launch data to %s: %w", outputPath, err)
+	}
+	return output.Close()
+}
+
+func putUint16(buf *bytes.Buffer, v uint16) {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	buf.Write(b)
+}
+
+func putUint32(buf *bytes.Buffer, v uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	buf.Write(b)
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUint32(buf, uint32(len(s)))
+	buf.WriteString(s)
+}
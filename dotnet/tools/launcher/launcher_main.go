@@ -11,25 +11,36 @@ import (
 )
 
 func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "launcher: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
 	diag(func() { fmt.Printf("launcher args: %s\n", strings.Join(os.Args, ",")) })
 	launchInfo, err := GetLaunchInfo(os.Args[0])
 	if err != nil {
-		panic(fmt.Sprintf("failed to get launch info: %s", err))
+		return fmt.Errorf("failed to get launch info: %w", err)
 	}
-	binaryType, present := launchInfo.Data["binary_type"]
+	binaryType, present := launchInfo.Data.Lookup("binary_type")
 	if !present {
-		panic(fmt.Sprintf("no binary type in launch info: %s", launchInfo))
+		return fmt.Errorf("no binary type in launch info: %v", launchInfo)
 	}
 
 	switch binaryType {
 	case "Dotnet":
 		launchInfo.Runfiles = GetRunfiles()
-		LaunchDotnet(os.Args, launchInfo)
+		return LaunchDotnet(os.Args, launchInfo)
 	case "DotnetPublish":
 		// when we're published, our runfiles were made by rules_msbuild, and the directory is guaranteed to be next to
 		// the assembly, no monkey business allowed
 
-		binName := path.Base(launchInfo.GetItem("assembly_name"))
+		assemblyName, err := launchInfo.GetItem("assembly_name")
+		if err != nil {
+			return err
+		}
+		binName := path.Base(assemblyName)
 		dir, _ := filepath.Split(os.Args[0])
 		runfilesDir := filepath.Join(dir, binName) + ".dll.runfiles"
 		_ = os.Setenv("RUNFILES_DIR", runfilesDir)
@@ -37,7 +48,8 @@ func main() {
 		_ = os.Setenv("RUNFILES_MANIFEST_ONLY", "0")
 		launchInfo.Runfiles = GetRunfiles()
 		LaunchDotnetPublish(os.Args, launchInfo)
+		return nil
 	default:
-		_, _ = fmt.Fprintf(os.Stderr, "unkown binary_type: %s", binaryType)
+		return fmt.Errorf("unkown binary_type: %s", binaryType)
 	}
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/execabs"
+)
+
+// Environment variables of the bazel test protocol
+// https://docs.bazel.build/versions/main/test-encyclopedia.html
+const (
+	testShardIndex      = "TEST_SHARD_INDEX"
+	testTotalShards     = "TEST_TOTAL_SHARDS"
+	testShardStatusFile = "TEST_SHARD_STATUS_FILE"
+	testBridgeTestOnly  = "TESTBRIDGE_TEST_ONLY"
+)
+
+// listTestsHeader is printed by `dotnet test --list-tests` before the names of the tests
+const listTestsHeader = "The following Tests are available:"
+
+// filterSpecialChars have to be escaped in the values of a `dotnet test --filter` expression
+// https://docs.microsoft.com/en-us/dotnet/core/testing/selective-unit-tests#character-escaping
+const filterSpecialChars = `\()&|=!~`
+
+// testShard is the shard of the tests this process should run
+type testShard struct {
+	index int
+	total int
+}
+
+// getTestShard reads the sharding environment variables that bazel sets for tests with a shard_count, and touches
+// the shard status file to let bazel know that we honour them. It returns nil when the test isn't sharded.
+func getTestShard() (*testShard, error) {
+	if statusFile := os.Getenv(testShardStatusFile); statusFile != "" {
+		f, err := os.Create(statusFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to touch shard status file %s: %w", statusFile, err)
+		}
+		_ = f.Close()
+	}
+
+	totalString := os.Getenv(testTotalShards)
+	if totalString == "" {
+		return nil, nil
+	}
+	total, err := strconv.Atoi(totalString)
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s: %s", testTotalShards, totalString)
+	}
+	index, err := strconv.Atoi(os.Getenv(testShardIndex))
+	if err != nil || index < 0 || index >= total {
+		return nil, fmt.Errorf("malformed %s: %s", testShardIndex, os.Getenv(testShardIndex))
+	}
+	if total <= 1 {
+		return nil, nil
+	}
+	return &testShard{index: index, total: total}, nil
+}
+
+// testFilter converts the value of `bazel test --test_filter` to a `dotnet test --filter` expression. Values that are
+// already filter expressions are passed through, otherwise the value is a comma separated list of (partial) test names.
+func testFilter(testOnly string) string {
+	testOnly = strings.TrimSpace(testOnly)
+	if testOnly == "" {
+		return ""
+	}
+	if strings.ContainsAny(testOnly, "=~!") {
+		return testOnly
+	}
+	var parts []string
+	for _, name := range strings.Split(testOnly, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		parts = append(parts, "FullyQualifiedName~"+escapeFilterValue(name))
+	}
+	return strings.Join(parts, "|")
+}
+
+// andFilters combines two filter expressions, either of which may be empty
+func andFilters(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return fmt.Sprintf("(%s)&(%s)", a, b)
+}
+
+func escapeFilterValue(value string) string {
+	var b strings.Builder
+	for _, c := range value {
+		if strings.ContainsRune(filterSpecialChars, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// testNamesFilter is a filter expression that selects exactly the named tests
+func testNamesFilter(names []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		// some adapters (i.e. NUnit) only list the method name of a test
+		property := "Name"
+		if strings.ContainsRune(name, '.') {
+			property = "FullyQualifiedName"
+		}
+		parts[i] = property + "=" + escapeFilterValue(name)
+	}
+	return strings.Join(parts, "|")
+}
+
+// parseTestList parses the output of `dotnet test --list-tests`. The names are sorted and de-duplicated, and the
+// arguments of data driven tests are dropped: filters only match the name of the test method.
+func parseTestList(output string) []string {
+	seen := map[string]bool{}
+	var tests []string
+	inList := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inList {
+			inList = strings.TrimSpace(line) == listTestsHeader
+			continue
+		}
+		// test names are indented, anything else is a message from the test host
+		if len(line) == 0 || (line[0] != ' ' && line[0] != '\t') {
+			continue
+		}
+		name := strings.TrimSpace(line)
+		if paren := strings.IndexRune(name, '('); paren >= 0 {
+			name = strings.TrimSpace(name[:paren])
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tests = append(tests, name)
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+// shardTests deterministically selects the tests of a shard: the sorted tests are dealt round-robin to the shards
+func (s *testShard) shardTests(tests []string) []string {
+	var selected []string
+	for i, name := range tests {
+		if i%s.total == s.index {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// listTests runs the command with `--list-tests` and parses its output
+func listTests(args []string) ([]string, error) {
+	args = append(args, "--list-tests")
+	diag(func() { fmt.Printf("==> listing tests: \"%s\"\n", strings.Join(args, "\" \"")) })
+	cmd := execabs.Command(args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tests with %s: %w\n%s", cmd.String(), err, output)
+	}
+	return parseTestList(string(output)), nil
+}
+
+// testArgs are the arguments that select the tests to run according to the bazel test protocol. When skip is set,
+// this shard has no tests to run.
+func testArgs(listArgs []string) (args []string, skip bool, err error) {
+	filter := testFilter(os.Getenv(testBridgeTestOnly))
+	shard, err := getTestShard()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if shard != nil {
+		listFilter := listArgs
+		if filter != "" {
+			listFilter = append(listFilter[:len(listFilter):len(listFilter)], "--filter", filter)
+		}
+		tests, err := listTests(listFilter)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(tests) == 0 {
+			// we couldn't tell the tests apart, the first shard runs all of them
+			diag(func() { fmt.Printf("no tests listed, running all tests in shard 0\n") })
+			if shard.index != 0 {
+				return nil, true, nil
+			}
+		} else {
+			selected := shard.shardTests(tests)
+			diag(func() { fmt.Printf("shard %d/%d: %s\n", shard.index, shard.total, strings.Join(selected, ", ")) })
+			if len(selected) == 0 {
+				return nil, true, nil
+			}
+			filter = andFilters(filter, testNamesFilter(selected))
+		}
+	}
+
+	if filter != "" {
+		args = []string{"--filter", filter}
+	}
+	return args, false, nil
+}
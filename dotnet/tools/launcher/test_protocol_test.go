@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+	"github.com/stretchr/testify/assert"
+)
+
+const listTestsOutput = `Microsoft (R) Test Execution Command Line Tool Version 16.11.0
+Copyright (c) Microsoft Corporation.  All rights reserved.
+
+The following Tests are available:
+    Tests.MathTests.Add(a: 1, b: 2)
+    Tests.MathTests.Add(a: 3, b: 4)
+    Tests.MathTests.Subtract
+    Tests.StringTests.Concat
+    Tests.DatabaseTests.Connect
+`
+
+func TestParseTestList(t *testing.T) {
+	tests := parseTestList(listTestsOutput)
+	assert.Equal(t, []string{
+		"Tests.DatabaseTests.Connect",
+		"Tests.MathTests.Add",
+		"Tests.MathTests.Subtract",
+		"Tests.StringTests.Concat",
+	}, tests)
+
+	assert.Empty(t, parseTestList("No test is available in foo.dll."))
+}
+
+func TestShardTests(t *testing.T) {
+	tests := []string{"a", "b", "c", "d", "e"}
+	var all []string
+	for i := 0; i < 3; i++ {
+		shard := &testShard{index: i, total: 3}
+		all = append(all, shard.shardTests(tests)...)
+	}
+	assert.ElementsMatch(t, tests, all)
+	assert.Equal(t, []string{"b", "e"}, (&testShard{index: 1, total: 3}).shardTests(tests))
+	assert.Empty(t, (&testShard{index: 5, total: 6}).shardTests(tests))
+}
+
+func TestTestFilter(t *testing.T) {
+	assert.Equal(t, "", testFilter(""))
+	assert.Equal(t, "FullyQualifiedName~MathTests", testFilter("MathTests"))
+	assert.Equal(t, "FullyQualifiedName~MathTests|FullyQualifiedName~Concat", testFilter("MathTests, Concat"))
+	assert.Equal(t, "Category=Unit", testFilter("Category=Unit"))
+	assert.Equal(t, `FullyQualifiedName~Add\(1\)`, testFilter("Add(1)"))
+}
+
+func TestTestNamesFilter(t *testing.T) {
+	filter := testNamesFilter([]string{"Tests.MathTests.Add", "Subtract"})
+	assert.Equal(t, "FullyQualifiedName=Tests.MathTests.Add|Name=Subtract", filter)
+	assert.Equal(t, "(a)&(b)", andFilters("a", "b"))
+	assert.Equal(t, "b", andFilters("", "b"))
+}
+
+func TestGetTestShard(t *testing.T) {
+	dir, err := ioutil.TempDir(bazel.TestTmpDir(), "shard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	statusFile := filepath.Join(dir, "status")
+
+	assert.NoError(t, os.Setenv(testShardStatusFile, statusFile))
+	assert.NoError(t, os.Setenv(testTotalShards, "4"))
+	assert.NoError(t, os.Setenv(testShardIndex, "2"))
+	defer func() {
+		_ = os.Unsetenv(testShardStatusFile)
+		_ = os.Unsetenv(testTotalShards)
+		_ = os.Unsetenv(testShardIndex)
+	}()
+
+	shard, err := getTestShard()
+	assert.NoError(t, err)
+	assert.Equal(t, &testShard{index: 2, total: 4}, shard)
+	assert.FileExists(t, statusFile)
+
+	assert.NoError(t, os.Setenv(testShardIndex, "4"))
+	_, err = getTestShard()
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Unsetenv(testTotalShards))
+	shard, err = getTestShard()
+	assert.NoError(t, err)
+	assert.Nil(t, shard)
+}
+
+func TestLogFile(t *testing.T) {
+	assert.NoError(t, os.Setenv("XML_OUTPUT_FILE", "/tmp/test.outputs/test.xml"))
+	defer func() { _ = os.Unsetenv("XML_OUTPUT_FILE") }()
+
+	assert.Equal(t, "/tmp/test.outputs/test.xml", logFile("junit"))
+	// bazel generates the xml when the logger doesn't write junit
+	assert.Equal(t, "test.trx", logFile("trx"))
+
+	assert.NoError(t, os.Unsetenv("XML_OUTPUT_FILE"))
+	assert.Equal(t, "test.xml", logFile("junit"))
+}
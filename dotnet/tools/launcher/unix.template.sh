@@ -123,10 +123,186 @@ fi
 assembly_args=("$target_bin_path" %assembly_args%)
 assembly_args+=("$@")
 dotnet_cmd="%dotnet_cmd%"
+dotnet_args=("$dotnet_cmd" %dotnet_args%)
+
+# escapes the characters that are special in a `dotnet test --filter` value
+escape_filter() {
+  sed -e 's/[\\()&|=!~]/\\&/g' <<< "$1"
+}
+
+# prints the `dotnet test --filter` expression that selects the tests of this shard
+shard_filter() {
+  local list_args=("${dotnet_args[@]}" "$target_bin_path" "--list-tests")
+  if [[ -n "$test_filter" ]]; then
+    list_args+=("--filter" "$test_filter")
+  fi
+  local i=0 name filter="" property
+  while IFS= read -r name; do
+    if (( i % TEST_TOTAL_SHARDS == TEST_SHARD_INDEX )); then
+      # some adapters (i.e. NUnit) only list the method name of a test
+      property="Name"
+      if [[ "$name" == *.* ]]; then
+        property="FullyQualifiedName"
+      fi
+      filter="${filter:+$filter|}$property=$(escape_filter "$name")"
+    fi
+    i=$((i + 1))
+  done < <("$dotnet_bin_path" "${list_args[@]}" |
+    # test names are indented after the header, the arguments of data driven tests are dropped
+    awk '/^The following Tests are available:/ { list = 1; next }
+      list && /^[ \t]/ { sub(/^[ \t]+/, ""); sub(/ *\(.*$/, ""); if ($0 != "") print }' |
+    LC_ALL=C sort -u)
+
+  if (( i == 0 )); then
+    # we couldn't tell the tests apart, the first shard runs all of them
+    if (( TEST_SHARD_INDEX == 0 )); then
+      echo "*"
+    fi
+  else
+    echo "$filter"
+  fi
+}
+
+# converts the Cobertura and OpenCover reports of coverlet in the results directory to lcov. Coverlet writes every
+# element on its own line, which lets us get away without an xml parser. A line that is reported more than once, by
+# several statements or reports, gets its most hits, like the launcher binary does.
+write_lcov() {
+  local reports=()
+  local report
+  while IFS= read -r report; do
+    reports+=("$report")
+  done < <(find "$1" -type f \( -iname '*.cobertura.xml' -o -iname '*.opencover.xml' \) 2>/dev/null | LC_ALL=C sort)
+  if [[ ${#reports[@]} -eq 0 ]]; then
+    echo >&2 "no coverage reports were found in $1, does the test project reference a coverage collector" \
+      "i.e. coverlet.collector?"
+    return 1
+  fi
+
+  awk '
+    function attr(name) {
+      if (match($0, " " name "=\"[^\"]*\"")) {
+        return substr($0, RSTART + length(name) + 3, RLENGTH - length(name) - 4)
+      }
+      return ""
+    }
+    # assemblies are built with deterministic source paths that replace the execroot with /_/
+    function workspace_path(p, i) {
+      gsub(/\\/, "/", p)
+      if (substr(p, 1, 3) == "/_/") return substr(p, 4)
+      if (i = index(p, "/execroot/")) {
+        p = substr(p, i + length("/execroot/"))
+        return substr(p, index(p, "/") + 1)
+      }
+      return p
+    }
+    FNR == 1 { source = ""; in_methods = 0; split("", files) }
+    # Cobertura
+    /<source>/ && source == "" { source = $0; gsub(/^[ \t]*<source>|\/?<\/source>.*$/, "", source) }
+    /<class / {
+      filename = attr("filename")
+      if (filename !~ /^(\/|[A-Za-z]:)/ && source != "") filename = source "/" filename
+      filename = workspace_path(filename)
+    }
+    /<methods>/ { in_methods = 1 }
+    /<\/methods>/ { in_methods = 0 }
+    /<line / && !in_methods { print filename "\t" attr("number") "\t" attr("hits") }
+    # OpenCover
+    /<File / { files[attr("uid")] = workspace_path(attr("fullPath")) }
+    /<SequencePoint / && (attr("fileid") in files) && attr("sl") > 0 {
+      print files[attr("fileid")] "\t" attr("sl") "\t" attr("vc")
+    }
+  ' "${reports[@]}" |
+    LC_ALL=C sort -t "$(printf '\t')" -k1,1 -k2,2n |
+    awk '
+      function end_line() {
+        if (line == "") return
+        printf "DA:%d,%d\n", line, hits
+        lf++
+        if (hits > 0) lh++
+        line = ""
+      }
+      function end_file() {
+        end_line()
+        if (file != "") printf "LH:%d\nLF:%d\nend_of_record\n", lh, lf
+      }
+      BEGIN { FS = "\t" }
+      $1 != file { end_file(); file = $1; lh = 0; lf = 0; print "SF:" file }
+      $2 != line { end_line(); line = $2; hits = $3 + 0; next }
+      $3 + 0 > hits { hits = $3 + 0 }
+      END { end_file() }
+    ' > "$COVERAGE_DIR/dotnet_coverage.dat"
+
+  # the merger overwrites COVERAGE_OUTPUT_FILE with the .dat files of COVERAGE_DIR when it is configured, otherwise our
+  # report is the output
+  cp "$COVERAGE_DIR/dotnet_coverage.dat" "$COVERAGE_OUTPUT_FILE"
+}
+
+collect_coverage=""
+results_dir=""
 if [[ $dotnet_cmd == "test" ]]; then
-  assembly_args+=("--logger" "%dotnet_logger%;%log_path_arg_name%=${XML_OUTPUT_FILE:-"test.xml"}")
+  # bazel only reads junit xml, the reports of other loggers, i.e. trx, are written to the results directory by name
+  log_file="${XML_OUTPUT_FILE:-"test.xml"}"
+  if [[ "%dotnet_logger%" != "junit" ]]; then
+    log_file="test.%dotnet_logger%"
+  fi
+  assembly_args+=("--logger" "%dotnet_logger%;%log_path_arg_name%=$log_file")
+
+  # map `bazel test --test_filter` to a filter expression, values that are already expressions are passed through
+  test_filter="${TESTBRIDGE_TEST_ONLY:-}"
+  if [[ -n "$test_filter" && "$test_filter" != *[=~!]* ]]; then
+    names="$test_filter"
+    test_filter=""
+    IFS=',' read -ra names <<< "$names"
+    for name in "${names[@]}"; do
+      name="${name#"${name%%[![:space:]]*}"}"
+      name="${name%"${name##*[![:space:]]}"}"
+      if [[ -n "$name" ]]; then
+        test_filter="${test_filter:+$test_filter|}FullyQualifiedName~$(escape_filter "$name")"
+      fi
+    done
+  fi
+
+  if [[ -n "${TEST_SHARD_STATUS_FILE:-}" ]]; then
+    touch "$TEST_SHARD_STATUS_FILE"
+  fi
+  if [[ "${TEST_TOTAL_SHARDS:-1}" -gt 1 ]]; then
+    filter="$(shard_filter)"
+    if [[ -z "$filter" ]]; then
+      # no tests to run in this shard
+      exit 0
+    elif [[ "$filter" != "*" ]]; then
+      if [[ -n "$test_filter" ]]; then
+        test_filter="($test_filter)&($filter)"
+      else
+        test_filter="$filter"
+      fi
+    fi
+  fi
+
+  if [[ -n "$test_filter" ]]; then
+    assembly_args+=("--filter" "$test_filter")
+  fi
+
+  if [[ -n "${COVERAGE_DIR:-}" && -n "${COVERAGE_OUTPUT_FILE:-}" ]]; then
+    collect_coverage=1
+    assembly_args+=("--collect" "%coverage_collector%")
+  fi
+  # attachments of the test run, i.e. coverage reports, are saved to test.outputs
+  results_dir="${TEST_UNDECLARED_OUTPUTS_DIR:-}"
+  if [[ -z "$results_dir" && -n "$collect_coverage" ]]; then
+    results_dir="$COVERAGE_DIR"
+  fi
+  if [[ -n "$results_dir" ]]; then
+    assembly_args+=("--results-directory" "$results_dir")
+  fi
 fi
 
-dotnet_args=("$dotnet_cmd" %dotnet_args%)
+if [[ -z "$collect_coverage" ]]; then
+  $dotnet_bin_path "${dotnet_args[@]}" "${assembly_args[@]}"
+  exit
+fi
 
-$dotnet_bin_path "${dotnet_args[@]}" "${assembly_args[@]}"
+status=0
+$dotnet_bin_path "${dotnet_args[@]}" "${assembly_args[@]}" || status=$?
+write_lcov "${results_dir:-TestResults}" || echo >&2 "failed to write coverage report"
+exit $status
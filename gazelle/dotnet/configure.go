@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"github.com/bazelbuild/bazel-gazelle/config"
 	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/samhowes/rules_msbuild/gazelle/dotnet/project"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -22,28 +24,71 @@ type dotnetConfig struct {
 	srcsModeString    string
 	debug             bool
 	frameworks        map[string]bool
+	evaluator         *project.Evaluator
+	feedFolders       []string
+	feed              *project.Feed
+	// packageResolves maps the lower case names of packages that are built in the workspace to the target that builds
+	// them, see the nuget_resolve directive
+	packageResolves map[string]label.Label
+	// mode is gazelle's -mode flag: fix, print or diff
+	mode string
 }
 
-func (dc *dotnetConfig) recordPackage(ref *project.PackageReference, tfm string) {
-	if dc.macroFileName == "" || tfm == "" {
+func (dc *dotnetConfig) recordPackage(ref *project.PackageReference, proj *project.Project, tfm string) {
+	if dc.macroFileName == "" || tfm == "" || ref.Version == "" {
+		return
+	}
+	r, err := project.ParseRange(ref.Version)
+	if err != nil {
+		log.Printf("%s: %v", ref.Include, err)
 		return
 	}
 	spec, exists := dc.packages[ref.Include]
-	v := project.ParseVersion(ref.Version)
 	if !exists {
-		if dc.debug {
-			log.Printf("adding package %s/%s", ref.Include, v.Raw)
-		}
-		dc.packages[ref.Include] = &project.NugetSpec{
-			Name:    ref.Include,
-			Version: v,
-			Tfms:    map[string]bool{tfm: true},
-		}
-		return
+		spec = &project.NugetSpec{Name: ref.Include}
+		dc.packages[ref.Include] = spec
 	}
+	if dc.debug {
+		log.Printf("adding package %s/%s for %s", ref.Include, r.Raw, tfm)
+	}
+
+	spec.Requests = append(spec.Requests, &project.PackageRequest{
+		Project: proj.FileLabel.String(),
+		Tfm:     tfm,
+		Range:   r,
+	})
+}
+
+// macroPath is the absolute path of the -deps_macro file
+func (dc *dotnetConfig) macroPath(c *config.Config) string {
+	macroPath := strings.Replace(dc.macroFileName, ":", "/", -1)
+	return filepath.Join(c.RepoRoot, filepath.Clean(macroPath))
+}
 
-	spec.Version = project.Best(spec.Version, v)
-	spec.Tfms[tfm] = true
+// lockFilePath is the absolute path of the lock file that is written next to the -deps_macro file
+func (dc *dotnetConfig) lockFilePath(c *config.Config) string {
+	return strings.TrimSuffix(dc.macroPath(c), ".bzl") + ".lock.json"
+}
+
+// addPackageResolve parses the arguments of a nuget_resolve directive: the name of a package and the label of the
+// target that builds it, relative to pkg. Package resolves apply to the whole workspace.
+func (dc *dotnetConfig) addPackageResolve(value, pkg string) error {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return fmt.Errorf("nuget_resolve: expected a package name and a label, got %q", value)
+	}
+	l, err := label.Parse(fields[1])
+	if err != nil {
+		return fmt.Errorf("nuget_resolve %s: %v", fields[0], err)
+	}
+	dc.packageResolves[strings.ToLower(fields[0])] = l.Abs("", pkg)
+	return nil
+}
+
+// resolvePackage returns the target in the workspace that builds the package, if any
+func (dc *dotnetConfig) resolvePackage(name string) (label.Label, bool) {
+	l, exists := dc.packageResolves[strings.ToLower(name)]
+	return l, exists
 }
 
 type macroFlag struct {
@@ -69,7 +114,11 @@ func (f macroFlag) String() string {
 }
 
 func (d *dotnetLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
-	dc := &dotnetConfig{packages: map[string]*project.NugetSpec{}, frameworks: map[string]bool{}}
+	dc := &dotnetConfig{
+		packages:        map[string]*project.NugetSpec{},
+		frameworks:      map[string]bool{},
+		packageResolves: map[string]label.Label{},
+	}
 	c.Exts[dotnetName] = dc
 	switch cmd {
 	case "fix", "update", "update-repos":
@@ -80,6 +129,11 @@ func (d *dotnetLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Confi
 			"deps_macro",
 			"Record nuget package versions and tfms in a macro after parsing all the project files. "+
 				"Strongly recommended for managing nuget packages.")
+		fs.Var(
+			&gzflag.MultiFlag{Values: &dc.feedFolders},
+			"nuget_feed",
+			"a local nuget feed or global packages folder, i.e. ~/.nuget/packages, to resolve transitive package "+
+				"dependencies from. May be repeated.")
 		fs.Var(
 			&gzflag.AllowedStringFlag{Value: &dc.srcsModeString, Allowed: []string{"implicit", "folders", "explicit"}},
 			"srcs_mode",
@@ -94,6 +148,30 @@ func (d *dotnetLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
 	if os.Getenv("DOTNET_GAZELLE_DEBUG") != "" {
 		dc.debug = true
 	}
+	dc.evaluator = project.NewEvaluator(c.RepoRoot)
+	if mode := fs.Lookup("mode"); mode != nil {
+		dc.mode = mode.Value.String()
+	}
+	if len(dc.feedFolders) > 0 {
+		folders := make([]string, len(dc.feedFolders))
+		for i, folder := range dc.feedFolders {
+			if strings.HasPrefix(folder, "~/") {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return err
+				}
+				folder = filepath.Join(home, folder[2:])
+			} else if !filepath.IsAbs(folder) {
+				folder = filepath.Join(c.RepoRoot, folder)
+			}
+			folders[i] = folder
+		}
+		feed, err := project.LoadFeed(folders)
+		if err != nil {
+			return err
+		}
+		dc.feed = feed
+	}
 	if dc.srcsModeString != "" {
 		mode, err := getSrcsMode(dc.srcsModeString, project.Implicit)
 		dc.srcsMode = mode
@@ -111,6 +189,12 @@ func (d *dotnetLang) KnownDirectives() []string {
 		"nuget_macro",
 		"public_nuget",
 		"public_nuget_frameworks",
+		"msbuild_sdk",
+		"nuget_resolve",
+		"msbuild_ignore_project",
+		"msbuild_ignore_package",
+		"msbuild_exclude_dirs",
+		"msbuild_test_sharding",
 	}
 }
 
@@ -127,28 +211,43 @@ func (d *dotnetLang) KnownDirectives() []string {
 // existing build file.
 func (d *dotnetLang) Configure(c *config.Config, rel string, f *rule.File) {
 	base := path.Base(rel)
-	if base == "node_modules" {
-		delete(c.Exts, dotnetDirName)
-		return
-	}
 	parent := getInfo(c)
 	if parent == nil && rel != "" {
 		// we explicitly decided to ignore this subtree
 		return
 	}
+	if parent != nil && parent.IsProjectOutput(base) {
+		// the macro already excludes the outputs of the project from its sources
+		delete(c.Exts, dotnetDirName)
+		return
+	}
+	if parent != nil && parent.ExcludesDir(base) {
+		parent.ExcludedChildren = append(parent.ExcludedChildren, base)
+		delete(c.Exts, dotnetDirName)
+		return
+	}
 	dc := getConfig(c)
 	if dc.debug {
 		log.Printf(rel)
 	}
 	self := project.DirectoryInfo{
 		Base:     base,
+		Path:     filepath.Join(c.RepoRoot, filepath.FromSlash(rel)),
+		Parent:   parent,
 		Children: map[string]*project.DirectoryInfo{},
 		Exts:     map[string][]string{},
 		SrcsMode: dc.srcsMode,
 	}
 	if parent != nil {
 		self.SrcsMode = parent.SrcsMode
+		self.Sdks = parent.Sdks
+		self.IgnoredProjects = parent.IgnoredProjects
+		self.IgnoredPackages = parent.IgnoredPackages
+		self.ExcludedDirs = parent.ExcludedDirs
+		self.MaxTestShards = parent.MaxTestShards
 		parent.Children[base] = &self
+	} else {
+		self.ExcludedDirs = project.DefaultExcludedDirs
 	}
 	c.Exts[dotnetDirName] = &self
 
@@ -164,6 +263,36 @@ func (d *dotnetLang) Configure(c *config.Config, rel string, f *rule.File) {
 			if err != nil {
 				log.Print(err)
 			}
+		case "msbuild_sdk":
+			sdks := self.SdkTable()
+			s, err := project.ParseSdk(d.Value, sdks)
+			if err != nil {
+				log.Printf("%s: %v", f.Path, err)
+				continue
+			}
+			// copy the table so the directive only applies to this directory and its children
+			self.Sdks = make(map[string]*project.Sdk, len(sdks)+1)
+			for k, v := range sdks {
+				self.Sdks[k] = v
+			}
+			self.Sdks[strings.ToLower(s.Name)] = s
+		case "msbuild_ignore_project":
+			self.IgnoredProjects = project.AppendNames(self.IgnoredProjects, strings.Fields(d.Value)...)
+		case "msbuild_ignore_package":
+			self.IgnoredPackages = project.AppendNames(self.IgnoredPackages, strings.Fields(d.Value)...)
+		case "msbuild_exclude_dirs":
+			self.ExcludedDirs = project.AppendNames(self.ExcludedDirs, strings.Fields(d.Value)...)
+		case "msbuild_test_sharding":
+			shards, err := project.ParseTestSharding(d.Value)
+			if err != nil {
+				log.Printf("%s: %v", f.Path, err)
+				continue
+			}
+			self.MaxTestShards = shards
+		case "nuget_resolve":
+			if err := dc.addPackageResolve(d.Value, f.Pkg); err != nil {
+				log.Printf("%s: %v", f.Path, err)
+			}
 		}
 	}
 }
@@ -0,0 +1,251 @@
+package dotnet
+
+import (
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const defsBzl = "@rules_msbuild//dotnet:defs.bzl"
+
+var assemblyKinds = map[string]bool{
+	"msbuild_library": true,
+	"msbuild_binary":  true,
+	"msbuild_test":    true,
+}
+
+// migration upgrades the shape of rules generated by older versions of rules_msbuild. Migrations run in order and
+// must be idempotent: a workspace generated by any older version is upgraded by running all of them.
+type migration struct {
+	description string
+	// changesLabels migrations only run with `gazelle fix`, `gazelle update` only warns about them
+	changesLabels bool
+	// migrate returns true if the file was changed, if apply is false nothing should be changed
+	migrate func(f *rule.File, apply bool) bool
+}
+
+var migrations = []migration{
+	{
+		description: "load rules from " + defsBzl,
+		migrate:     migrateLoads,
+	},
+	{
+		description: "remove the msbuild_properties attribute, properties are read from the project file",
+		migrate:     migrateProperties,
+	},
+	{
+		description: "use nuget_deps_helper for nuget_fetch deps",
+		migrate:     migrateNugetFetchRules,
+	},
+	{
+		description:   "drop the .Net suffix from rules that don't conflict with another rule",
+		changesLabels: true,
+		migrate:       migrateNetSuffix,
+	},
+}
+
+// Fix migrates rules generated by older versions of rules_msbuild
+func (d *dotnetLang) Fix(c *config.Config, f *rule.File) {
+	for _, m := range migrations {
+		apply := c.ShouldFix || !m.changesLabels
+		if !m.migrate(f, apply) {
+			continue
+		}
+		if apply {
+			log.Printf("%s: %s", f.Path, m.description)
+		} else {
+			log.Printf("%s: run `gazelle fix` to %s", f.Path, m.description)
+		}
+	}
+}
+
+// privateSymbols maps symbols that used to be loaded from rules_msbuild's private files to their public names
+var privateSymbols = map[string]string{
+	"msbuild_binary_macro":  "msbuild_binary",
+	"msbuild_library_macro": "msbuild_library",
+	"msbuild_test_macro":    "msbuild_test",
+	"msbuild_directory":     "msbuild_directory",
+	"nuget_fetch":           "nuget_fetch",
+	"nuget_deps_helper":     "nuget_deps_helper",
+}
+
+func migrateLoads(f *rule.File, apply bool) bool {
+	var legacy []*rule.Load
+	for _, l := range f.Loads {
+		if strings.HasPrefix(l.Name(), "@rules_msbuild//dotnet/private") {
+			legacy = append(legacy, l)
+		}
+	}
+	changed := false
+	for _, l := range legacy {
+		for _, pair := range l.SymbolPairs() {
+			public, ok := privateSymbols[pair.From]
+			if !ok {
+				continue
+			}
+			changed = true
+			if !apply {
+				continue
+			}
+			for _, r := range f.Rules {
+				if r.Kind() == pair.To {
+					r.SetKind(public)
+				}
+			}
+			l.Remove(pair.To)
+			addLoad(f, defsBzl, l.Index(), public)
+		}
+		if apply && l.IsEmpty() {
+			l.Delete()
+		}
+	}
+	return changed
+}
+
+func migrateProperties(f *rule.File, apply bool) bool {
+	changed := false
+	for _, r := range f.Rules {
+		if !assemblyKinds[r.Kind()] || r.Attr("msbuild_properties") == nil {
+			continue
+		}
+		changed = true
+		if apply {
+			r.DelAttr("msbuild_properties")
+		}
+	}
+	return changed
+}
+
+func migrateNugetFetchRules(f *rule.File, apply bool) bool {
+	changed := false
+	for _, r := range f.Rules {
+		if r.Kind() != "nuget_fetch" || !migrateNugetFetch(r, apply) {
+			continue
+		}
+		changed = true
+		if apply {
+			addLoad(f, "@rules_msbuild//deps:public_nuget.bzl", r.Index(), "FRAMEWORKS", "PACKAGES")
+			addLoad(f, defsBzl, r.Index(), "nuget_deps_helper")
+		}
+	}
+	return changed
+}
+
+// addLoad adds symbols to the load of name, if f doesn't load name yet a load is inserted before the statement at
+// index. WORKSPACE files are sensitive to the order of their statements, so loads aren't sorted or moved.
+func addLoad(f *rule.File, name string, index int, symbols ...string) {
+	for _, l := range f.Loads {
+		if l.Name() == name {
+			for _, s := range symbols {
+				l.Add(s)
+			}
+			return
+		}
+	}
+	l := rule.NewLoad(name)
+	for _, s := range symbols {
+		l.Add(s)
+	}
+	l.Insert(f, index)
+}
+
+// migrateNugetFetch converts the deps of a nuget_fetch rule from the literal spec list that nuget_deps_helper
+// produces, `["tfm,tfm", "Package/Version:tfm,tfm"]`, to the packages and target_frameworks attributes.
+func migrateNugetFetch(r *rule.Rule, apply bool) bool {
+	list, ok := r.Attr("deps").(*bzl.ListExpr)
+	if !ok {
+		return false
+	}
+	if !apply {
+		return true
+	}
+
+	frameworks := map[string]bool{}
+	for _, tfm := range r.AttrStrings("target_frameworks") {
+		frameworks[tfm] = true
+	}
+	packages, _ := r.Attr("packages").(*bzl.DictExpr)
+	if packages == nil {
+		packages = &bzl.DictExpr{ForceMultiLine: true}
+	}
+	for _, e := range list.List {
+		s, ok := e.(*bzl.StringExpr)
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(s.Value, ":", 2)
+		var tfms []bzl.Expr
+		for _, tfm := range strings.Split(parts[len(parts)-1], ",") {
+			if tfm == "" {
+				continue
+			}
+			frameworks[tfm] = true
+			tfms = append(tfms, &bzl.StringExpr{Value: tfm})
+		}
+		if len(parts) == 1 {
+			continue
+		}
+		packages.List = append(packages.List, &bzl.KeyValueExpr{
+			Key:   &bzl.StringExpr{Value: parts[0]},
+			Value: &bzl.ListExpr{List: tfms},
+		})
+	}
+
+	var frameworksList []string
+	for tfm := range frameworks {
+		frameworksList = append(frameworksList, tfm)
+	}
+	sort.Strings(frameworksList)
+	r.SetAttr("packages", packages)
+	r.SetAttr("target_frameworks", frameworksList)
+	r.SetAttr("deps", &bzl.CallExpr{
+		X: &bzl.Ident{Name: "nuget_deps_helper"},
+		List: []bzl.Expr{
+			&bzl.Ident{Name: "FRAMEWORKS"},
+			&bzl.Ident{Name: "PACKAGES"},
+		},
+	})
+	return true
+}
+
+// migrateNetSuffix renames `Name.Net` rules back to `Name` when gazelle wouldn't add the suffix anymore: the suffix is
+// only added to libraries and tests in a directory with protos, so the rule is renamed when the file has no
+// proto_library rules or it is a binary, and no other rule is named `Name`.
+func migrateNetSuffix(f *rule.File, apply bool) bool {
+	names := map[string]bool{}
+	hasProtos := false
+	for _, r := range f.Rules {
+		names[r.Name()] = true
+		if r.Kind() == "proto_library" {
+			hasProtos = true
+		}
+	}
+
+	changed := false
+	for _, r := range f.Rules {
+		if !assemblyKinds[r.Kind()] || !strings.HasSuffix(r.Name(), ".Net") {
+			continue
+		}
+		name := strings.TrimSuffix(r.Name(), ".Net")
+		projectFile := r.AttrString("project_file")
+		if strings.TrimSuffix(projectFile, path.Ext(projectFile)) != name || names[name] {
+			continue
+		}
+		if hasProtos && r.Kind() != "msbuild_binary" {
+			continue
+		}
+		changed = true
+		if !apply {
+			continue
+		}
+		log.Printf("%s: renaming %s to %s, update any references to it that gazelle doesn't manage", f.Path, r.Name(), name)
+		r.SetName(name)
+		r.DelAttr("project_file")
+	}
+	return changed
+}
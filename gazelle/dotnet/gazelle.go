@@ -53,11 +53,17 @@ func (d *dotnetLang) Loads() []rule.LoadInfo {
 
 var commonInfo = rule.KindInfo{
 	MergeableAttrs: map[string]bool{
-		"srcs":             true,
-		"target_framework": true,
-		"protos":           true,
+		"srcs":              true,
+		"resources":         true,
+		"target_framework":  true,
+		"target_frameworks": true,
+		"protos":            true,
+		"references":        true,
+		"shard_count":       true,
+		"dotnet_logger":     true,
+		"log_path_arg_name": true,
 	},
-	ResolveAttrs: map[string]bool{"deps": true},
+	ResolveAttrs: map[string]bool{"deps": true, "private_deps": true},
 }
 
 var kinds = map[string]rule.KindInfo{
@@ -68,15 +74,19 @@ var kinds = map[string]rule.KindInfo{
 		"srcs": true,
 		"deps": true,
 	}},
+	"msbuild_solution": {
+		MergeableAttrs: map[string]bool{
+			"srcs":           true,
+			"configurations": true,
+		},
+		ResolveAttrs: map[string]bool{"deps": true},
+	},
 	"nuget_fetch": {},
 	"nuget_deps_helper": {MergeableAttrs: map[string]bool{
 		"target_frameworks": true,
 	}},
 }
 
-func (d *dotnetLang) Fix(c *config.Config, f *rule.File) {
-}
-
 func getInfo(c *config.Config) *project.DirectoryInfo {
 	i, exists := c.Exts[dotnetDirName]
 	if !exists {
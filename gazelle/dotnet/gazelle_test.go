@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -61,9 +62,11 @@ func TestGazelleBinary(t *testing.T) {
 
 func testPath(t *testing.T, testName string, repos bool, files []bazel.RunfileEntry) {
 	t.Run(testName, func(t *testing.T) {
-		var args []string
+		var args, positional []string
 		var inputs []testtools.FileSpec
 		var goldens []testtools.FileSpec
+		// the exit code and stderr of gazelle are only checked when the test case declares them
+		expected := expectedResult{}
 
 		for _, f := range files {
 			trim := testDataPath + testName + "/"
@@ -84,7 +87,24 @@ func testPath(t *testing.T, testName string, repos bool, files []bazel.RunfileEn
 			}
 
 			// Now trim the common prefix off.
-			if strings.HasSuffix(shortPath, ".in") {
+			if shortPath == "args.txt" {
+				// the gazelle command to run followed by its positional arguments
+				fields := strings.Fields(string(content))
+				if len(fields) == 0 {
+					t.Fatalf("%s is empty, expected a gazelle command", f.Path)
+				}
+				args = append(args, fields[:1]...)
+				positional = append(positional, fields[1:]...)
+			} else if shortPath == "expectedExitCode.txt" {
+				code, err := strconv.Atoi(strings.TrimSpace(string(content)))
+				if err != nil {
+					t.Fatalf("%s: %v", f.Path, err)
+				}
+				expected.exitCode = code
+			} else if shortPath == "expectedStderr.txt" {
+				stderr := string(content)
+				expected.stderr = &stderr
+			} else if strings.HasSuffix(shortPath, ".in") {
 				inputs = append(inputs, testtools.FileSpec{
 					Path:    strings.TrimSuffix(shortPath, ".in"),
 					Content: string(content),
@@ -115,12 +135,11 @@ func testPath(t *testing.T, testName string, repos bool, files []bazel.RunfileEn
 			defer cleanup()
 		}
 
-		if !repos {
-			runCommand(t, dir, args...)
-		} else {
+		if repos {
 			args = append(args, "-deps_macro=deps/nuget.bzl%nuget_deps")
-			runCommand(t, dir, args...)
 		}
+		args = append(args, "-build_file_name=BUILD")
+		runCommand(t, dir, expected, append(args, positional...)...)
 
 		testtools.CheckFiles(t, dir, goldens)
 		if t.Failed() {
@@ -135,8 +154,12 @@ func testPath(t *testing.T, testName string, repos bool, files []bazel.RunfileEn
 	})
 }
 
-func runCommand(t *testing.T, dir string, args ...string) {
-	args = append(args, "-build_file_name=BUILD")
+type expectedResult struct {
+	exitCode int
+	stderr   *string
+}
+
+func runCommand(t *testing.T, dir string, expected expectedResult, args ...string) {
 	cmd := exec.Command(gazellePath, args...)
 	var stdout bytes.Buffer
 	cmd.Stdout = os.Stdout
@@ -151,9 +174,18 @@ func runCommand(t *testing.T, dir string, args ...string) {
 
 	t.Logf("stdout: %s", stdout.String())
 	t.Logf("stderr: %s", stderr.String())
-	if err != nil {
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
 		t.Fatal(err)
 	}
+	if exitCode != expected.exitCode {
+		t.Fatalf("expected exit code %d, got %d: %s", expected.exitCode, exitCode, stderr.String())
+	}
+	if expected.stderr != nil && stderr.String() != *expected.stderr {
+		t.Errorf("expected stderr:\n%s\ngot:\n%s", *expected.stderr, stderr.String())
+	}
 }
 
 func findGazelle() string {
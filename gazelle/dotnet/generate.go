@@ -3,7 +3,9 @@ package dotnet
 import (
 	"fmt"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
 	"log"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -34,7 +36,10 @@ func (d *dotnetLang) GenerateRules(args language.GenerateArgs) language.Generate
 	}
 	for _, f := range append(args.RegularFiles, args.GenFiles...) {
 		if strings.HasSuffix(f, "proj") {
-			info.Project = loadProject(args, f)
+			if info.IgnoresProject(f) {
+				continue
+			}
+			info.Project = loadProject(args, f, info)
 			info.Project.Directory = info
 			continue
 		}
@@ -64,19 +69,134 @@ func (d *dotnetLang) GenerateRules(args language.GenerateArgs) language.Generate
 		}
 	}
 
-	if info.Project == nil {
-		return res
+	if info.Project != nil {
+		r := info.Project.GenerateRule(args.File)
+		dropUnmergeable(args.File, r)
+		res.Gen = append(res.Gen, r)
+
+		res.Imports = append(res.Imports, info.Project.Deps)
+		for _, tfm := range info.Project.TargetFrameworks {
+			dc.frameworks[tfm] = true
+		}
 	}
 
-	r := info.Project.GenerateRule(args.File)
-	res.Gen = append(res.Gen, r)
+	generateSolutions(args, info, &res)
+	return res
+}
 
-	res.Imports = append(res.Imports, info.Project.Deps)
-	if info.Project.TargetFramework != "" {
-		dc.frameworks[info.Project.TargetFramework] = true
+// dropUnmergeable deletes the mergeable attributes of the existing rule for r that gazelle can't merge with the
+// generated ones, i.e. `glob(...) + [...]`, so that the generated values replace them. Gazelle only merges strings and lists, it would log
+// "could not merge expression" and keep the stale value. Attributes marked with `# keep` are left alone.
+func dropUnmergeable(f *rule.File, r *rule.Rule) {
+	if f == nil {
+		return
 	}
+	for _, existing := range f.Rules {
+		if existing.Kind() != r.Kind() || existing.Name() != r.Name() || existing.ShouldKeep() {
+			continue
+		}
+		for _, key := range existing.AttrKeys() {
+			if !kinds[existing.Kind()].MergeableAttrs[key] {
+				continue
+			}
+			value := existing.Attr(key)
+			if generated := r.Attr(key); generated == nil || (plainExpr(value) && plainExpr(generated)) {
+				continue
+			}
+			if rule.ShouldKeep(value) || attrKept(f, value) {
+				continue
+			}
+			existing.DelAttr(key)
+		}
+	}
+}
 
-	return res
+// plainExpr reports whether gazelle can merge e: a string or a list
+func plainExpr(e bzl.Expr) bool {
+	switch e.(type) {
+	case *bzl.StringExpr, *bzl.ListExpr:
+		return true
+	}
+	return false
+}
+
+// attrKept reports whether the assignment of value in f has a `# keep` comment, rule.Rule only exposes the right hand
+// side of an attribute
+func attrKept(f *rule.File, value bzl.Expr) bool {
+	kept := false
+	bzl.Walk(f.File, func(x bzl.Expr, _ []bzl.Expr) {
+		if a, ok := x.(*bzl.AssignExpr); ok && a.RHS == value && rule.ShouldKeep(a) {
+			kept = true
+		}
+	})
+	return kept
+}
+
+// generateSolutions generates an msbuild_solution rule for each solution file in the directory that depends on every
+// project in the solution. Projects that aren't in the workspace are reported as comments on the rule.
+func generateSolutions(args language.GenerateArgs, info *project.DirectoryInfo, res *language.GenerateResult) {
+	dir := project.Forward(args.Dir)
+	repoRoot := project.Forward(args.Config.RepoRoot)
+	for _, f := range info.Exts[".sln"] {
+		sln, err := project.ParseSolution(filepath.Join(args.Dir, f))
+		if err != nil {
+			log.Printf("%s: failed to parse solution file. Skipping. Parsing error: %v", f, err)
+			continue
+		}
+
+		var deps []interface{}
+		for _, p := range sln.Projects {
+			dep := &projectDep{}
+			deps = append(deps, dep)
+			if folder := p.FolderPath(); folder != "" {
+				dep.Notes = append(dep.Notes, fmt.Sprintf("solution folder: %s", folder))
+			}
+			for _, guid := range p.Dependencies {
+				if d := sln.Project(guid); d == nil || d.TypeGuid == project.SolutionFolderType {
+					dep.Comments = append(dep.Comments, fmt.Sprintf("%s depends on %s, but it is not a project in the solution", p.Path, guid))
+				}
+			}
+
+			switch {
+			case !strings.HasSuffix(p.Path, "proj"):
+				dep.Label = label.NoLabel
+				dep.Comments = append(dep.Comments, fmt.Sprintf("%s: unsupported project type %s", p.Path, p.TypeGuid))
+				continue
+			case !p.IsBuilt():
+				dep.Label = label.NoLabel
+				dep.Comments = append(dep.Comments, fmt.Sprintf("%s is not built by any solution configuration", p.Path))
+				continue
+			}
+
+			l, err := project.GetLabel(dir, p.Path, repoRoot)
+			if err != nil {
+				dep.Label = label.NoLabel
+				dep.Comments = append(dep.Comments, fmt.Sprintf("could not add solution project: %v", err))
+				continue
+			}
+			if _, err = os.Stat(filepath.Join(args.Config.RepoRoot, filepath.FromSlash(path.Join(l.Pkg, l.Name)))); err != nil {
+				dep.Label = label.NoLabel
+				dep.Comments = append(dep.Comments, fmt.Sprintf("%s is in the solution, but not in the workspace", p.Path))
+				continue
+			}
+			dep.Label = l
+		}
+
+		name := sln.Name
+		for _, r := range res.Gen {
+			if r.Name() == name {
+				name += "_sln"
+				break
+			}
+		}
+		r := rule.NewRule("msbuild_solution", name)
+		r.SetAttr("srcs", []string{f})
+		if len(sln.Configurations) > 0 {
+			r.SetAttr("configurations", sln.Configurations)
+		}
+		res.Gen = append(res.Gen, r)
+		res.Imports = append(res.Imports, deps)
+	}
 }
 
 func generateDirectoryDefaults(args language.GenerateArgs, info *project.DirectoryInfo, res *language.GenerateResult) {
@@ -90,7 +210,7 @@ func generateDirectoryDefaults(args language.GenerateArgs, info *project.Directo
 		case "directory.build.props":
 			fallthrough
 		default:
-			proj := loadProject(args, p)
+			proj := loadProject(args, p, nil)
 			if proj == nil {
 				continue
 			}
@@ -116,16 +236,20 @@ func generateDirectoryDefaults(args language.GenerateArgs, info *project.Directo
 	}
 }
 
-func loadProject(args language.GenerateArgs, projectFile string) *project.Project {
+// loadProject loads a project file, if dir is not nil the project inherits the properties msbuild would import from
+// the directory tree i.e. Directory.Build.props
+func loadProject(args language.GenerateArgs, projectFile string, dir *project.DirectoryInfo) *project.Project {
 	// squash the error, we know we're under the repo root
 	l, _ := project.GetLabel(project.Forward(args.Dir), projectFile, project.Forward(args.Config.RepoRoot))
-	proj, err := project.Load(filepath.Join(args.Dir, projectFile))
+	dc := getConfig(args.Config)
+	proj, err := dc.evaluator.Load(filepath.Join(args.Dir, projectFile), dir)
 	if err != nil {
 		log.Printf("%s: failed to parse project file. Skipping. This may result in incomplete build "+
 			"definitions. Parsing error: %v", projectFile, err)
 		return nil
 	}
 	proj.FileLabel = &l
+	proj.BuildFileNames = args.Config.ValidBuildFileNames
 
 	processDeps(args, proj)
 	return proj
@@ -135,9 +259,9 @@ func processDeps(args language.GenerateArgs, proj *project.Project) {
 	dir := project.Forward(args.Dir)
 	repoRoot := project.Forward(args.Config.RepoRoot)
 
-	addDep := func(unsupported project.Unsupported, str string, isImport bool) {
+	addDep := func(unsupported project.Unsupported, str string, isImport bool, messages ...string) {
 		dep := projectDep{IsImport: isImport}
-		dep.Comments = unsupported.Append(dep.Comments, "", true)
+		dep.Comments = unsupported.Append(messages, "", true)
 		if isImport && len(dep.Comments) > 0 {
 			return
 		}
@@ -153,33 +277,75 @@ func processDeps(args language.GenerateArgs, proj *project.Project) {
 	}
 
 	dc := getConfig(args.Config)
+	info := getInfo(args.Config)
+	var packages []string
+	addPackage := func(ref *project.PackageReference, tfms []string, messages []string) {
+		dep := projectDep{IsPackage: true}
+		dep.Comments = ref.Unsupported.Append(messages, "", false)
+		dep.Comments = append(dep.Comments, ref.Evaluate(proj)...)
+		packages = append(packages, ref.Include)
+		if info.IgnoresPackage(ref.Include) {
+			return
+		}
+
+		if l, exists := dc.resolvePackage(ref.Include); exists {
+			// the package is built in the workspace, it isn't fetched from nuget
+			dep.Label = l
+			proj.Deps = append(proj.Deps, &dep)
+			return
+		}
+
+		for _, tfm := range tfms {
+			dc.recordPackage(ref, proj, tfm)
+		}
+
+		dep.IsPrivate = ref.IsPrivate()
+		dep.Label = label.Label{
+			Repo: "nuget",
+			Pkg:  ref.Include,
+			Name: ref.Include,
+		}
+		proj.Deps = append(proj.Deps, &dep)
+	}
+
 	for _, i := range proj.Imports {
+		if i.Sdk != "" || !i.Test(proj, true) {
+			continue
+		}
 		i.Evaluate(proj)
+		if strings.Contains(i.Project, "$(") {
+			// imports of the msbuild toolset, i.e. $(MSBuildToolsPath)\Microsoft.CSharp.targets, aren't in the workspace
+			continue
+		}
 		addDep(i.Unsupported, i.Project, true)
 	}
 	for _, ig := range proj.ItemGroups {
+		if len(proj.Frameworks(&ig.Conditional)) == 0 {
+			continue
+		}
 		for _, ref := range ig.ProjectReferences {
+			if len(proj.Frameworks(&ig.Conditional, &ref.Conditional)) == 0 {
+				continue
+			}
 			ref.Evaluate(proj)
-			addDep(ref.Unsupported, ref.Include, false)
+			addDep(ref.Unsupported, ref.Include, false, ref.ConditionMessages("ProjectReference")...)
 		}
 		for _, ref := range ig.PackageReferences {
-			dep := projectDep{IsPackage: true}
-			dep.Comments = ref.Unsupported.Append(dep.Comments, "", false)
-
-			ref.Evaluate(proj)
-			switch strings.ToLower(ref.Include) {
-			case "microsoft.net.test.sdk":
-				proj.IsTest = true
-			}
-
-			dc.recordPackage(ref, proj.TargetFramework)
-
-			dep.Label = label.Label{
-				Repo: "nuget",
-				Pkg:  ref.Include,
-				Name: ref.Include,
+			tfms := proj.Frameworks(&ig.Conditional, &ref.Conditional)
+			if len(tfms) == 0 {
+				continue
 			}
-			proj.Deps = append(proj.Deps, &dep)
+			addPackage(ref, tfms, ref.ConditionMessages("PackageReference"))
 		}
 	}
+	for _, ref := range proj.GlobalPackageReferences {
+		addPackage(ref, proj.Frameworks(), nil)
+	}
+	for _, ref := range proj.PackagesConfig {
+		addPackage(ref, proj.Frameworks(), nil)
+	}
+	for _, ref := range proj.SdkPackages {
+		addPackage(ref, proj.Frameworks(), nil)
+	}
+	proj.ClassifyTest(packages)
 }
@@ -0,0 +1,55 @@
+package project
+
+import "strings"
+
+// https://docs.microsoft.com/en-us/nuget/consume-packages/package-references-in-project-files#controlling-dependency-assets
+
+// parseAssets parses a `;` separated list of asset types i.e. `runtime; build; analyzers`. `all` and `none` are
+// returned as is, and an empty value is def.
+func parseAssets(value, def string) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		value = def
+	}
+	assets := map[string]bool{}
+	for _, a := range strings.Split(value, ";") {
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "" {
+			assets[a] = true
+		}
+	}
+	return assets
+}
+
+// assetTypes are the types of the assets that a package contributes to a project
+var assetTypes = []string{
+	"compile", "runtime", "contentfiles", "build", "buildmultitargeting", "buildtransitive", "analyzers", "native",
+}
+
+// usedAssets returns the types of the assets of the package that the project uses
+func (r *PackageReference) usedAssets() []string {
+	include := parseAssets(r.IncludeAssets, "all")
+	exclude := parseAssets(r.ExcludeAssets, "none")
+	var used []string
+	for _, a := range assetTypes {
+		if (include["all"] || include[a]) && !exclude["all"] && !exclude[a] {
+			used = append(used, a)
+		}
+	}
+	return used
+}
+
+// IsPrivate reports whether the package is only used to build the project: none of the assets it contributes flow to
+// the consumers of the project, i.e. `PrivateAssets="all"` for SourceLink and analyzers. Runtime only packages, i.e.
+// `ExcludeAssets="compile"`, still flow: the consumers need their runtime and native assets.
+func (r *PackageReference) IsPrivate() bool {
+	// contentfiles, analyzers and build are private by default
+	private := parseAssets(r.PrivateAssets, "contentfiles;analyzers;build")
+	if private["all"] {
+		return true
+	}
+	for _, a := range r.usedAssets() {
+		if !private[a] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,464 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/msbuild-conditions
+
+// buildTimeProperties are properties that are only known when msbuild actually executes. They depend on the
+// bazel configuration (i.e. `--compilation_mode`) or on the host, so gazelle can't decide conditions on them.
+var buildTimeProperties = map[string]bool{
+	"configuration":      true,
+	"platform":           true,
+	"platformtarget":     true,
+	"runtimeidentifier":  true,
+	"os":                 true,
+	"msbuildruntimetype": true,
+}
+
+// Conditional is embedded in every element that supports the MSBuild Condition attribute
+type Conditional struct {
+	Condition    string `xml:"Condition,attr"`
+	conditionErr error
+}
+
+// Test evaluates the Condition attribute against the properties of p. If gazelle is not able to decide the
+// condition, undecided is returned and the reason is reported by ConditionMessages
+func (c *Conditional) Test(p *Project, undecided bool) bool {
+	c.conditionErr = nil
+	if strings.TrimSpace(c.Condition) == "" {
+		return true
+	}
+	result, err := p.EvaluateCondition(c.Condition)
+	if err != nil {
+		c.conditionErr = err
+		return undecided
+	}
+	return result
+}
+
+// ConditionMessages returns a message describing why the condition could not be evaluated, if any
+func (c *Conditional) ConditionMessages(prefix string) []string {
+	if c.conditionErr == nil {
+		return nil
+	}
+	if prefix != "" {
+		prefix = prefix + " "
+	}
+	return []string{fmt.Sprintf("could not evaluate %scondition %q: %v", prefix, c.Condition, c.conditionErr)}
+}
+
+// EvaluateCondition evaluates an MSBuild condition expression using the properties of the project.
+// An error is returned if the expression is malformed or depends on information that is only available when
+// msbuild is executing.
+func (p *Project) EvaluateCondition(condition string) (bool, error) {
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return false, err
+	}
+	parser := conditionParser{tokens: tokens, proj: p}
+	v, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return false, fmt.Errorf("unexpected token %q", parser.tokens[parser.pos].value)
+	}
+	b, ok := v.bool()
+	if !ok {
+		return false, fmt.Errorf("expression %q does not evaluate to a boolean", v.s)
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokString tokenKind = iota
+	tokProperty
+	tokWord
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type conditionToken struct {
+	kind  tokenKind
+	value string
+}
+
+func tokenizeCondition(s string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, conditionToken{tokString, s[i+1 : i+1+end]})
+			i += end + 2
+		case c == '$' || c == '@' || c == '%':
+			end := matchingParen(s, i+1)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c( at position %d", c, i)
+			}
+			tokens = append(tokens, conditionToken{tokProperty, s[i : end+1]})
+			i = end + 1
+		case c == '(':
+			tokens = append(tokens, conditionToken{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, conditionToken{tokRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, conditionToken{tokComma, ","})
+			i++
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" {
+				return nil, fmt.Errorf("unexpected '=' at position %d, did you mean '=='?", i)
+			}
+			tokens = append(tokens, conditionToken{tokOp, op})
+			i += len(op)
+		default:
+			start := i
+			for i < len(s) && isWordChar(s[i]) {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, conditionToken{tokWord, s[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '+'
+}
+
+// matchingParen returns the index of the parenthesis closing the one at s[open], or -1
+func matchingParen(s string, open int) int {
+	if open >= len(s) || s[open] != '(' {
+		return -1
+	}
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+type conditionValue struct {
+	s string
+}
+
+func (v conditionValue) bool() (bool, bool) {
+	switch strings.ToLower(v.s) {
+	case "true", "on", "yes", "!false", "!off", "!no":
+		return true, true
+	case "false", "off", "no", "!true", "!on", "!yes":
+		return false, true
+	}
+	return false, false
+}
+
+func (v conditionValue) number() (float64, bool) {
+	s := strings.TrimSpace(v.s)
+	if strings.HasPrefix(strings.ToLower(s), "0x") {
+		n, err := strconv.ParseInt(s[2:], 16, 64)
+		return float64(n), err == nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	proj   *Project
+	// skipping is set while parsing an operand that doesn't affect the result, only syntax errors are reported
+	skipping bool
+}
+
+func (c *conditionParser) peek() *conditionToken {
+	if c.pos >= len(c.tokens) {
+		return nil
+	}
+	return &c.tokens[c.pos]
+}
+
+func (c *conditionParser) isWord(word string) bool {
+	t := c.peek()
+	return t != nil && t.kind == tokWord && strings.EqualFold(t.value, word)
+}
+
+func (c *conditionParser) parseOr() (conditionValue, error) {
+	return c.parseLogical("or", c.parseAnd)
+}
+
+func (c *conditionParser) parseAnd() (conditionValue, error) {
+	return c.parseLogical("and", c.parseNot)
+}
+
+// parseLogical short-circuits like msbuild: once the left operand decides the result, the right operand is only
+// parsed, it is not evaluated, so it may depend on build-time properties without making the condition undecidable.
+func (c *conditionParser) parseLogical(op string, next func() (conditionValue, error)) (conditionValue, error) {
+	left, err := next()
+	if err != nil {
+		return left, err
+	}
+	for c.isWord(op) {
+		c.pos++
+		l, lok := left.bool()
+		if lok && !c.skipping && l == (op == "or") {
+			c.skipping = true
+			_, err := next()
+			c.skipping = false
+			if err != nil {
+				return left, err
+			}
+			continue
+		}
+		right, err := next()
+		if err != nil {
+			return right, err
+		}
+		if c.skipping {
+			continue
+		}
+		r, rok := right.bool()
+		if !lok || !rok {
+			return left, fmt.Errorf("operands of '%s' must be booleans", op)
+		}
+		if op == "and" {
+			left = boolValue(l && r)
+		} else {
+			left = boolValue(l || r)
+		}
+	}
+	return left, nil
+}
+
+func (c *conditionParser) parseNot() (conditionValue, error) {
+	if t := c.peek(); t != nil && t.kind == tokOp && t.value == "!" {
+		c.pos++
+		v, err := c.parseNot()
+		if err != nil {
+			return v, err
+		}
+		b, ok := v.bool()
+		if !ok && !c.skipping {
+			return v, fmt.Errorf("operand of '!' must be a boolean, got %q", v.s)
+		}
+		return boolValue(!b), nil
+	}
+	return c.parseComparison()
+}
+
+func (c *conditionParser) parseComparison() (conditionValue, error) {
+	left, err := c.parsePrimary()
+	if err != nil {
+		return left, err
+	}
+	t := c.peek()
+	if t == nil || t.kind != tokOp || t.value == "!" {
+		return left, nil
+	}
+	c.pos++
+	right, err := c.parsePrimary()
+	if err != nil {
+		return right, err
+	}
+
+	ln, lnum := left.number()
+	rn, rnum := right.number()
+	switch t.value {
+	case "==", "!=":
+		lb, lbool := left.bool()
+		rb, rbool := right.bool()
+		var equal bool
+		if lnum && rnum {
+			equal = ln == rn
+		} else if lbool && rbool {
+			equal = lb == rb
+		} else {
+			equal = strings.EqualFold(left.s, right.s)
+		}
+		return boolValue(equal == (t.value == "==")), nil
+	}
+	if (!lnum || !rnum) && !c.skipping {
+		return left, fmt.Errorf("operands of '%s' must be numbers, got %q and %q", t.value, left.s, right.s)
+	}
+	switch t.value {
+	case "<":
+		return boolValue(ln < rn), nil
+	case "<=":
+		return boolValue(ln <= rn), nil
+	case ">":
+		return boolValue(ln > rn), nil
+	default:
+		return boolValue(ln >= rn), nil
+	}
+}
+
+func (c *conditionParser) parsePrimary() (conditionValue, error) {
+	t := c.peek()
+	if t == nil {
+		return conditionValue{}, fmt.Errorf("unexpected end of condition")
+	}
+	c.pos++
+	switch t.kind {
+	case tokLParen:
+		v, err := c.parseOr()
+		if err != nil {
+			return v, err
+		}
+		if n := c.peek(); n == nil || n.kind != tokRParen {
+			return v, fmt.Errorf("missing ')'")
+		}
+		c.pos++
+		return v, nil
+	case tokString, tokProperty:
+		if c.skipping {
+			return conditionValue{t.value}, nil
+		}
+		s, err := c.proj.expandCondition(t.value)
+		return conditionValue{s}, err
+	case tokWord:
+		if n := c.peek(); n != nil && n.kind == tokLParen {
+			return c.parseFunction(t.value)
+		}
+		return conditionValue{t.value}, nil
+	}
+	return conditionValue{}, fmt.Errorf("unexpected token %q", t.value)
+}
+
+func (c *conditionParser) parseFunction(name string) (conditionValue, error) {
+	c.pos++ // (
+	var args []conditionValue
+	for {
+		t := c.peek()
+		if t == nil {
+			return conditionValue{}, fmt.Errorf("missing ')' for function %s", name)
+		}
+		if t.kind == tokRParen {
+			c.pos++
+			break
+		}
+		if len(args) > 0 {
+			if t.kind != tokComma {
+				return conditionValue{}, fmt.Errorf("expected ',' in arguments to %s", name)
+			}
+			c.pos++
+		}
+		v, err := c.parsePrimary()
+		if err != nil {
+			return v, err
+		}
+		args = append(args, v)
+	}
+
+	if c.skipping {
+		return conditionValue{}, nil
+	}
+	if len(args) != 1 {
+		return conditionValue{}, fmt.Errorf("function %s expects 1 argument, got %d", name, len(args))
+	}
+	arg := args[0].s
+	switch strings.ToLower(name) {
+	case "exists":
+		if strings.TrimSpace(arg) == "" {
+			return boolValue(false), nil
+		}
+		p := Forward(arg)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(c.proj.dir, p)
+		}
+		_, err := os.Stat(p)
+		return boolValue(err == nil), nil
+	case "hastrailingslash":
+		return boolValue(strings.HasSuffix(arg, "/") || strings.HasSuffix(arg, "\\")), nil
+	}
+	return conditionValue{}, fmt.Errorf("unsupported function %s", name)
+}
+
+func boolValue(b bool) conditionValue {
+	if b {
+		return conditionValue{"true"}
+	}
+	return conditionValue{"false"}
+}
+
+// expandCondition substitutes properties in s the way msbuild does when evaluating a condition: undefined properties
+// are empty strings. Property functions, item lists, item metadata and build-time properties can't be evaluated.
+func (p *Project) expandCondition(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c != '$' && c != '@' && c != '%') || i+1 >= len(s) || s[i+1] != '(' {
+			b.WriteByte(c)
+			continue
+		}
+		end := matchingParen(s, i+1)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %c( in %q", c, s)
+		}
+		switch c {
+		case '@':
+			return "", fmt.Errorf("item lists are not supported: %s", s[i:end+1])
+		case '%':
+			return "", fmt.Errorf("item metadata is not supported: %s", s[i:end+1])
+		}
+		name := strings.TrimSpace(s[i+2 : end])
+		for j := 0; j < len(name); j++ {
+			if !(isWordChar(name[j]) && name[j] != '.' && name[j] != '+') {
+				return "", fmt.Errorf("property functions are not supported: %s", s[i:end+1])
+			}
+		}
+		value, exists := p.lookupProperty(name)
+		if !exists && buildTimeProperties[strings.ToLower(name)] {
+			return "", fmt.Errorf("$(%s) is only known at build time", name)
+		}
+		b.WriteString(value)
+		i = end
+	}
+	return b.String(), nil
+}
+
+// lookupProperty finds a property by name, property names are case insensitive in msbuild
+func (p *Project) lookupProperty(name string) (string, bool) {
+	if v, exists := p.Properties[name]; exists {
+		return v, true
+	}
+	for k, v := range p.Properties {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
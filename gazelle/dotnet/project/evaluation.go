@@ -0,0 +1,244 @@
+package project
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/build-process-overview#evaluation-phase
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/customize-your-build#directorybuildprops-and-directorybuildtargets
+
+const (
+	directoryBuildProps    = "Directory.Build.props"
+	directoryBuildTargets  = "Directory.Build.targets"
+	directoryPackagesProps = "Directory.Packages.props"
+)
+
+// Evaluator loads projects along with the files msbuild would import while evaluating their properties. Parsed
+// imports are cached, so an Evaluator should be shared by every project in a workspace.
+type Evaluator struct {
+	// RepoRoot bounds the files that will be imported: anything outside of the repository is not under the
+	// control of gazelle, i.e. the SDK props, and is ignored.
+	RepoRoot string
+	files    map[string]*Project
+}
+
+func NewEvaluator(repoRoot string) *Evaluator {
+	return &Evaluator{RepoRoot: repoRoot, files: map[string]*Project{}}
+}
+
+// Load parses projectFile and evaluates its properties. If dir is not nil, properties are layered the way msbuild
+// does: first the nearest Directory.Build.props, then the project file itself following its Import elements in
+// document order, then the nearest Directory.Build.targets.
+func (e *Evaluator) Load(projectFile string, dir *DirectoryInfo) (*Project, error) {
+	proj, err := parseProject(projectFile)
+	if err != nil {
+		return nil, err
+	}
+	proj.Properties = make(map[string]string)
+	proj.srcsModes = make(map[string]SrcsMode)
+	proj.dir = filepath.Dir(projectFile)
+	proj.repoRoot = e.RepoRoot
+
+	visited := map[string]bool{}
+	var packagesProps string
+	if dir != nil {
+		if props := dir.FindUp(directoryBuildProps); props != "" {
+			e.importFile(proj, props, visited)
+		}
+		// the sdk imports Directory.Packages.props right after Directory.Build.props
+		if packagesProps = dir.FindUp(directoryPackagesProps); packagesProps != "" {
+			e.importFile(proj, packagesProps, visited)
+		}
+	}
+	e.evaluateFile(proj, proj, projectFile, visited)
+	if dir != nil {
+		if targets := dir.FindUp(directoryBuildTargets); targets != "" {
+			e.importFile(proj, targets, visited)
+		}
+	}
+
+	proj.initialize(projectFile, dir.SdkTable())
+	if proj.IsLegacy {
+		if err = proj.loadPackagesConfig(); err != nil {
+			return nil, err
+		}
+	}
+	if proj.ManagePackageVersionsCentrally && packagesProps != "" {
+		if packages := e.files[filepath.Clean(packagesProps)]; packages != nil {
+			proj.loadPackageVersions(packages)
+		}
+	}
+	return proj, nil
+}
+
+// loadPackageVersions evaluates the PackageVersion and GlobalPackageReference items of Directory.Packages.props
+// https://docs.microsoft.com/en-us/nuget/consume-packages/central-package-management
+func (p *Project) loadPackageVersions(packages *Project) {
+	p.PackageVersions = map[string]*PackageReference{}
+	for _, ig := range packages.ItemGroups {
+		if !ig.Test(p, false) {
+			continue
+		}
+		for _, v := range ig.PackageVersions {
+			if !v.Test(p, false) {
+				continue
+			}
+			version := PackageReference{Include: p.Evaluate(v.Include), Version: v.Version}
+			if version.Version == "" && v.VersionEl != nil {
+				version.Version = v.VersionEl.Value
+			}
+			version.Version = p.Evaluate(strings.TrimSpace(version.Version))
+			p.PackageVersions[strings.ToLower(version.Include)] = &version
+		}
+		for _, g := range ig.GlobalPackageReferences {
+			if !g.Test(p, false) {
+				continue
+			}
+			ref := *g
+			ref.Include = p.Evaluate(ref.Include)
+			if ref.Version == "" && ref.VersionEl != nil {
+				ref.Version = ref.VersionEl.Value
+			}
+			// global references carry their own version, treat it as an override of the central version
+			ref.VersionOverride = ref.Version
+			ref.Version = ""
+			ref.VersionEl = nil
+			p.GlobalPackageReferences = append(p.GlobalPackageReferences, &ref)
+		}
+	}
+}
+
+func parseProject(projectFile string) (*Project, error) {
+	var proj Project
+	contents, err := ioutil.ReadFile(projectFile)
+	if err != nil {
+		return nil, err
+	}
+	err = xml.Unmarshal(contents, &proj)
+	if err != nil {
+		return nil, err
+	}
+	proj.LangExt = strings.TrimSuffix(path.Ext(projectFile), "proj")
+	proj.parseMetadata()
+	proj.order = elementOrder(contents)
+	return &proj, nil
+}
+
+// elementOrder lists the names of the children of the root element in document order. encoding/xml groups
+// elements by type, but properties and imports have to be evaluated in the order they are declared.
+func elementOrder(contents []byte) []string {
+	var order []string
+	d := xml.NewDecoder(bytes.NewReader(contents))
+	depth := 0
+	for {
+		t, err := d.Token()
+		if err == io.EOF || err != nil {
+			return order
+		}
+		switch el := t.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				order = append(order, el.Name.Local)
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func (e *Evaluator) importFile(proj *Project, file string, visited map[string]bool) {
+	file = filepath.Clean(file)
+	if visited[file] {
+		return
+	}
+	imported, exists := e.files[file]
+	if !exists {
+		var err error
+		imported, err = parseProject(file)
+		if err != nil {
+			// msbuild would fail, but we'll do the best we can and let msbuild report it
+			imported = nil
+		}
+		e.files[file] = imported
+	}
+	if imported == nil {
+		return
+	}
+	e.evaluateFile(proj, imported, file, visited)
+}
+
+// evaluateFile evaluates the property groups and imports of file into the properties of proj
+func (e *Evaluator) evaluateFile(proj, file *Project, filePath string, visited map[string]bool) {
+	visited[filepath.Clean(filePath)] = true
+	pgIndex, importIndex := 0, 0
+	for _, name := range file.order {
+		switch name {
+		case "PropertyGroup":
+			proj.evaluatePropertyGroup(file.PropertyGroups[pgIndex])
+			pgIndex++
+		case "Import":
+			for _, i := range e.resolveImport(proj, filePath, file.Imports[importIndex]) {
+				e.importFile(proj, i, visited)
+			}
+			importIndex++
+		}
+	}
+}
+
+func (p *Project) evaluatePropertyGroup(pg *PropertyGroup) {
+	// properties we can't decide on are left alone: there is no way to represent them in the build file
+	if !pg.Test(p, false) {
+		return
+	}
+	for i := range pg.Properties {
+		prop := &pg.Properties[i]
+		if !prop.Test(p, false) {
+			continue
+		}
+		// msbuild expands properties when they are defined, this allows <Foo>$(Foo);bar</Foo>
+		p.Properties[prop.XMLName.Local] = p.Evaluate(prop.Value)
+	}
+}
+
+// resolveImport returns the files in the repository matched by the Project attribute of i
+func (e *Evaluator) resolveImport(proj *Project, filePath string, i *Import) []string {
+	if i.Project == "" || i.Sdk != "" || !i.Test(proj, false) {
+		return nil
+	}
+	dir := filepath.Dir(filePath)
+	importPath := i.Project
+	for k, v := range map[string]string{
+		"$(MSBuildThisFileDirectory)": dir + "/",
+		"$(MSBuildThisFile)":          filepath.Base(filePath),
+		"$(MSBuildProjectDirectory)":  proj.dir,
+	} {
+		importPath = strings.ReplaceAll(importPath, k, v)
+	}
+	importPath = Forward(proj.Evaluate(importPath))
+	if strings.Contains(importPath, "$(") {
+		return nil
+	}
+	if !filepath.IsAbs(importPath) {
+		importPath = filepath.Join(dir, importPath)
+	}
+	importPath = filepath.Clean(importPath)
+	if e.RepoRoot != "" {
+		rel, err := filepath.Rel(e.RepoRoot, importPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	matches, err := filepath.Glob(importPath)
+	if err != nil {
+		return nil
+	}
+	return matches
+}
@@ -0,0 +1,398 @@
+package project
+
+import (
+	"archive/zip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/nuget/reference/nuspec
+// https://docs.microsoft.com/en-us/nuget/concepts/dependency-resolution
+
+type nuspec struct {
+	Metadata struct {
+		Id           string `xml:"id"`
+		Version      string `xml:"version"`
+		Dependencies struct {
+			Dependencies []*nuspecDependency `xml:"dependency"`
+			Groups       []*nuspecGroup      `xml:"group"`
+		} `xml:"dependencies"`
+	} `xml:"metadata"`
+}
+
+type nuspecGroup struct {
+	TargetFramework string              `xml:"targetFramework,attr"`
+	Dependencies    []*nuspecDependency `xml:"dependency"`
+}
+
+type nuspecDependency struct {
+	Id      string `xml:"id,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// FeedPackage is a single version of a package in a Feed
+type FeedPackage struct {
+	Id      string
+	Version *NugetVer
+	// frameworks are the target frameworks of the dependency groups, nil for a group that applies to any framework
+	frameworks []*Framework
+	groups     [][]*PackageDependency
+	nupkg      string
+	// sha512 is the hash file the global packages folder writes when a package is extracted
+	sha512 string
+}
+
+// PackageDependency is a dependency of a package as declared in its nuspec
+type PackageDependency struct {
+	Id    string
+	Range *VersionRange
+}
+
+// Feed is an index of the nuspec files in local package sources: folders of .nupkg files or the global packages
+// folder, i.e. ~/.nuget/packages, where packages are extracted.
+type Feed struct {
+	// packages maps the lower case id of a package to its versions, lowest first
+	packages map[string][]*FeedPackage
+}
+
+// LoadFeed indexes every .nupkg and .nuspec file under the given folders
+func LoadFeed(folders []string) (*Feed, error) {
+	f := &Feed{packages: map[string][]*FeedPackage{}}
+	for _, folder := range folders {
+		err := filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			var addErr error
+			switch strings.ToLower(path.Ext(p)) {
+			case ".nupkg":
+				addErr = f.addNupkg(p)
+			case ".nuspec":
+				addErr = f.addNuspec(p)
+			}
+			if addErr != nil {
+				// partial or corrupt packages are common in the global packages folder, one of them shouldn't prevent
+				// using the rest of the feed
+				log.Printf("skipping %s: %v", p, addErr)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error loading nuget feed %s: %v", folder, err)
+		}
+	}
+	for _, versions := range f.packages {
+		sort.Slice(versions, func(i, j int) bool {
+			return CompareVersions(versions[i].Version, versions[j].Version) < 0
+		})
+	}
+	return f, nil
+}
+
+func (f *Feed) addNuspec(p string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return f.add(file, p)
+}
+
+func (f *Feed) addNupkg(p string) error {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, entry := range r.File {
+		// the manifest is the only .nuspec file at the root of the package
+		if strings.Contains(entry.Name, "/") || !strings.HasSuffix(strings.ToLower(entry.Name), ".nuspec") {
+			continue
+		}
+		contents, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		defer contents.Close()
+		return f.add(contents, p)
+	}
+	return fmt.Errorf("no .nuspec file found")
+}
+
+func (f *Feed) add(r io.Reader, source string) error {
+	var spec nuspec
+	if err := xml.NewDecoder(r).Decode(&spec); err != nil {
+		return err
+	}
+	v, err := ParseVersion(spec.Metadata.Version)
+	if err != nil {
+		return err
+	}
+	key := strings.ToLower(spec.Metadata.Id)
+	if existing := f.Find(key, v); existing != nil {
+		// the global packages folder has both the .nupkg and the extracted .nuspec
+		existing.addSource(source)
+		return nil
+	}
+
+	pkg := &FeedPackage{Id: spec.Metadata.Id, Version: v}
+	pkg.addSource(source)
+	deps := spec.Metadata.Dependencies
+	if len(deps.Dependencies) > 0 {
+		// the legacy format without groups applies to every framework
+		deps.Groups = append(deps.Groups, &nuspecGroup{Dependencies: deps.Dependencies})
+	}
+	for _, g := range deps.Groups {
+		var framework *Framework
+		if g.TargetFramework != "" {
+			var ok bool
+			if framework, ok = ParseFramework(g.TargetFramework); !ok {
+				continue
+			}
+		}
+		var group []*PackageDependency
+		for _, d := range g.Dependencies {
+			version := d.Version
+			if strings.TrimSpace(version) == "" {
+				// a dependency without a version accepts any version
+				version = "[0.0.0, )"
+			}
+			r, err := ParseRange(version)
+			if err != nil {
+				log.Printf("%s: skipping dependency %s: %v", source, d.Id, err)
+				continue
+			}
+			group = append(group, &PackageDependency{Id: d.Id, Range: r})
+		}
+		pkg.frameworks = append(pkg.frameworks, framework)
+		pkg.groups = append(pkg.groups, group)
+	}
+	f.packages[key] = append(f.packages[key], pkg)
+	return nil
+}
+
+func (p *FeedPackage) addSource(source string) {
+	if strings.ToLower(path.Ext(source)) == ".nupkg" {
+		p.nupkg = source
+		return
+	}
+	hash := filepath.Join(filepath.Dir(source), fmt.Sprintf("%s.%s.nupkg.sha512", strings.ToLower(p.Id), p.Version))
+	if _, err := os.Stat(hash); err == nil {
+		p.sha512 = hash
+	}
+}
+
+// ContentHash returns the base64 encoded SHA512 hash of the .nupkg the way NuGet records it in lock files, or an
+// empty string if the feed only has the package's nuspec
+func (p *FeedPackage) ContentHash() (string, error) {
+	if p.sha512 != "" {
+		hash, err := ioutil.ReadFile(p.sha512)
+		return strings.TrimSpace(string(hash)), err
+	}
+	if p.nupkg == "" {
+		return "", nil
+	}
+	file, err := os.Open(p.nupkg)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha512.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Find returns the package with the exact id and version, or nil if it isn't in the feed
+func (f *Feed) Find(id string, v *NugetVer) *FeedPackage {
+	for _, p := range f.packages[strings.ToLower(id)] {
+		if CompareVersions(p.Version, v) == 0 {
+			return p
+		}
+	}
+	return nil
+}
+
+// Lowest returns the lowest version of a package in the feed that satisfies every range
+func (f *Feed) Lowest(id string, ranges []*VersionRange) *FeedPackage {
+	for _, p := range f.packages[strings.ToLower(id)] {
+		satisfied := true
+		for _, r := range ranges {
+			if !r.Satisfies(p.Version) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return p
+		}
+	}
+	return nil
+}
+
+// Dependencies returns the dependencies of the package for the nearest dependency group to tfm
+func (p *FeedPackage) Dependencies(tfm *Framework) []*PackageDependency {
+	if i := tfm.Nearest(p.frameworks); i >= 0 {
+		return p.groups[i]
+	}
+	return nil
+}
+
+// Closure adds the transitive dependencies of packages for each target framework. NuGet's rules are followed:
+// the version of a package nearest to the project wins, and of the versions that satisfy a dependency the lowest
+// version in the feed is chosen. Messages describe packages missing from the feed and requests that lost to a nearer
+// version.
+func (f *Feed) Closure(packages map[string]*NugetSpec) (map[string]*NugetSpec, []string) {
+	// the direct dependencies, per framework
+	direct := map[string]map[string]*NugetVer{}
+	var tfms []string
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		versions, _ := packages[name].Resolve()
+		for _, v := range versions {
+			for tfm := range v.Tfms {
+				if _, exists := direct[tfm]; !exists {
+					direct[tfm] = map[string]*NugetVer{}
+					tfms = append(tfms, tfm)
+				}
+				direct[tfm][name] = v.Version
+			}
+		}
+	}
+	sort.Strings(tfms)
+
+	closure := map[string]*NugetSpec{}
+	for name, spec := range packages {
+		closure[name] = &NugetSpec{Name: spec.Name, Requests: append([]*PackageRequest{}, spec.Requests...)}
+	}
+	var messages []string
+	for _, tfm := range tfms {
+		framework, ok := ParseFramework(tfm)
+		if !ok {
+			messages = append(messages, fmt.Sprintf("unknown target framework %s, transitive packages are not resolved for it", tfm))
+			continue
+		}
+		messages = append(messages, f.resolveFramework(tfm, framework, direct[tfm], closure)...)
+	}
+	return closure, messages
+}
+
+type dependencyRequest struct {
+	*PackageDependency
+	parent string
+}
+
+func (f *Feed) resolveFramework(tfm string, framework *Framework, direct map[string]*NugetVer, closure map[string]*NugetSpec) []string {
+	var messages []string
+	// resolved maps the lower case id of a package to the version chosen at the nearest depth
+	resolved := map[string]*NugetVer{}
+	var level []*FeedPackage
+	names := make([]string, 0, len(direct))
+	for name := range direct {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := direct[name]
+		resolved[strings.ToLower(name)] = v
+		if p := f.Find(name, v); p != nil {
+			level = append(level, p)
+		} else {
+			messages = append(messages, fmt.Sprintf("%s/%s is not in the nuget feed, its dependencies for %s are not resolved", name, v, tfm))
+		}
+	}
+
+	for len(level) > 0 {
+		requests := map[string][]*dependencyRequest{}
+		var ids []string
+		for _, p := range level {
+			parent := fmt.Sprintf("%s/%s", p.Id, p.Version)
+			for _, d := range p.Dependencies(framework) {
+				key := strings.ToLower(d.Id)
+				if v, exists := resolved[key]; exists {
+					if !d.Range.Satisfies(v) {
+						messages = append(messages, fmt.Sprintf("%s requires %s %s for %s, but %s was resolved",
+							parent, d.Id, d.Range, tfm, v))
+					}
+					continue
+				}
+				if _, exists := requests[key]; !exists {
+					ids = append(ids, key)
+				}
+				requests[key] = append(requests[key], &dependencyRequest{d, parent})
+			}
+		}
+		sort.Strings(ids)
+
+		level = nil
+		for _, key := range ids {
+			reqs := requests[key]
+			ranges := make([]*VersionRange, len(reqs))
+			for i, r := range reqs {
+				ranges[i] = r.Range
+			}
+
+			var v *NugetVer
+			name := reqs[0].Id
+			p := f.Lowest(name, ranges)
+			if p != nil {
+				v, name = p.Version, p.Id
+				level = append(level, p)
+			} else {
+				var err error
+				if v, err = Resolve(ranges); v == nil {
+					messages = append(messages, fmt.Sprintf("%s for %s: %v", name, tfm, err))
+					continue
+				}
+				messages = append(messages, fmt.Sprintf("%s/%s is not in the nuget feed, its dependencies for %s are not resolved", name, v, tfm))
+			}
+			resolved[key] = v
+
+			spec := FindSpec(closure, name)
+			if spec == nil {
+				spec = &NugetSpec{Name: name}
+				closure[name] = spec
+			}
+			for _, r := range reqs {
+				spec.Requests = append(spec.Requests, &PackageRequest{
+					Project:    r.parent,
+					Tfm:        tfm,
+					Range:      ExactRange(v),
+					Transitive: true,
+				})
+			}
+		}
+	}
+	return messages
+}
+
+// FindSpec looks up a package by its id, package ids are case-insensitive
+func FindSpec(packages map[string]*NugetSpec, name string) *NugetSpec {
+	if spec, ok := packages[name]; ok {
+		return spec
+	}
+	for n, spec := range packages {
+		if strings.EqualFold(n, name) {
+			return spec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package project
+
+import (
+	"strconv"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/dotnet/standard/frameworks
+
+const (
+	NetFramework = "netframework"
+	NetCoreApp   = "netcoreapp"
+	NetStandard  = "netstandard"
+)
+
+// Framework is a target framework i.e. `net5.0`, `netstandard2.0` or `net48` and the long form used in nuspec files
+// i.e. `.NETStandard2.0` or `.NETFramework4.7.2`
+type Framework struct {
+	Family  string
+	Version [4]int
+}
+
+// ParseFramework parses a target framework moniker, ok is false if the framework isn't one of the families gazelle
+// knows about
+func ParseFramework(tfm string) (f *Framework, ok bool) {
+	s := strings.ToLower(strings.TrimSpace(tfm))
+	// net5.0-windows is still net5.0
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Replace(s, ",version=v", "", 1)
+
+	f = &Framework{}
+	var version string
+	switch {
+	case strings.HasPrefix(s, ".netstandard"):
+		f.Family, version = NetStandard, s[len(".netstandard"):]
+	case strings.HasPrefix(s, "netstandard"):
+		f.Family, version = NetStandard, s[len("netstandard"):]
+	case strings.HasPrefix(s, ".netcoreapp"):
+		f.Family, version = NetCoreApp, s[len(".netcoreapp"):]
+	case strings.HasPrefix(s, "netcoreapp"):
+		f.Family, version = NetCoreApp, s[len("netcoreapp"):]
+	case strings.HasPrefix(s, ".netframework"):
+		f.Family, version = NetFramework, s[len(".netframework"):]
+	case strings.HasPrefix(s, "net"):
+		version = s[len("net"):]
+		if strings.Contains(version, ".") {
+			// net5.0 and above are .NETCoreApp
+			f.Family = NetCoreApp
+		} else {
+			// net472 is .NETFramework 4.7.2
+			f.Family = NetFramework
+			version = strings.Join(strings.Split(version, ""), ".")
+		}
+	default:
+		return nil, false
+	}
+
+	parts := strings.Split(version, ".")
+	if version == "" || len(parts) > len(f.Version) {
+		return nil, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		f.Version[i] = n
+	}
+	return f, true
+}
+
+func (f *Framework) compareVersion(o *Framework) int {
+	for i := range f.Version {
+		if c := compareInts(f.Version[i], o.Version[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// netStandard returns the highest version of .NET Standard that the framework implements, or nil if it doesn't
+// implement .NET Standard
+func (f *Framework) netStandard() *Framework {
+	v := func(major, minor int) *Framework {
+		return &Framework{Family: NetStandard, Version: [4]int{major, minor}}
+	}
+	at := func(version ...int) bool {
+		o := Framework{}
+		copy(o.Version[:], version)
+		return f.compareVersion(&o) >= 0
+	}
+	switch f.Family {
+	case NetStandard:
+		return f
+	case NetCoreApp:
+		switch {
+		case at(3):
+			return v(2, 1)
+		case at(2):
+			return v(2, 0)
+		default:
+			return v(1, 6)
+		}
+	case NetFramework:
+		switch {
+		case at(4, 6, 1):
+			return v(2, 0)
+		case at(4, 6):
+			return v(1, 3)
+		case at(4, 5, 1):
+			return v(1, 2)
+		case at(4, 5):
+			return v(1, 1)
+		}
+	}
+	return nil
+}
+
+// IsCompatible reports whether a project targeting f can use assets built for o
+func (f *Framework) IsCompatible(o *Framework) bool {
+	if f.Family == o.Family {
+		return f.compareVersion(o) >= 0
+	}
+	if o.Family != NetStandard {
+		return false
+	}
+	std := f.netStandard()
+	return std != nil && std.compareVersion(o) >= 0
+}
+
+// Nearest returns the index of the framework in candidates that is the best match for f the way NuGet picks
+// dependency groups: the highest compatible version of the same family, then the highest compatible .NET Standard.
+// A nil candidate matches any framework, but only if nothing else does. -1 is returned if nothing is compatible.
+func (f *Framework) Nearest(candidates []*Framework) int {
+	best, fallback := -1, -1
+	for i, c := range candidates {
+		if c == nil {
+			if fallback < 0 {
+				fallback = i
+			}
+			continue
+		}
+		if !f.IsCompatible(c) {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		b := candidates[best]
+		if b.Family != c.Family {
+			if c.Family == f.Family {
+				best = i
+			}
+			continue
+		}
+		if c.compareVersion(b) > 0 {
+			best = i
+		}
+	}
+	if best < 0 {
+		return fallback
+	}
+	return best
+}
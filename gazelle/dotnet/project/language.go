@@ -0,0 +1,22 @@
+package project
+
+// https://docs.microsoft.com/en-us/dotnet/core/project-sdk/msbuild-props#default-item-inclusion-properties
+// https://docs.microsoft.com/en-us/dotnet/visual-basic/developing-apps/development-with-my/
+
+// language describes the files a project language builds besides its own source files
+type language struct {
+	// Srcs are extensions of files that are compiled with the sources
+	Srcs []string
+	// Content are extensions of designer files that the build reads, i.e. the settings of the `My Project` folder of a
+	// Visual Basic project
+	Content []string
+}
+
+// defaultResources are extensions of files that SDK projects embed in the assembly whatever their language
+var defaultResources = []string{".resx"}
+
+// languages are keyed by the extension of the source files of the language
+var languages = map[string]language{
+	".cs": {Srcs: []string{".cshtml"}},
+	".vb": {Content: []string{".settings", ".myapp"}},
+}
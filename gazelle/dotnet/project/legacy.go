@@ -0,0 +1,142 @@
+package project
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/samhowes/rules_msbuild/gazelle/dotnet/util"
+)
+
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/msbuild-project-file-schema-reference
+// https://docs.microsoft.com/en-us/nuget/reference/packages-config
+
+const msbuildNamespace = "http://schemas.microsoft.com/developer/msbuild/2003"
+
+type packagesConfig struct {
+	Packages []struct {
+		Id      string `xml:"id,attr"`
+		Version string `xml:"version,attr"`
+	} `xml:"package"`
+}
+
+// isLegacy detects projects in the format used before the SDK: they have no Sdk attribute and declare the msbuild
+// namespace or a ToolsVersion
+func (p *Project) isLegacy() bool {
+	return p.Sdk == "" && (p.ToolsVersion != "" || p.XMLName.Space == msbuildNamespace)
+}
+
+// isConfigurationCondition is true for the conditions on $(Configuration) and $(Platform) that every legacy project
+// declares i.e. `'$(Configuration)|$(Platform)' == 'Debug|AnyCPU'`. The build decides both, there is nothing to report.
+func (p *Project) isConfigurationCondition(condition string) bool {
+	if !p.IsLegacy {
+		return false
+	}
+	matches := variableRegex.FindAllStringSubmatch(condition, -1)
+	for _, m := range matches {
+		switch strings.ToLower(m[1]) {
+		case "configuration", "platform":
+		default:
+			return false
+		}
+	}
+	return len(matches) > 0
+}
+
+// legacyFramework converts a TargetFrameworkVersion i.e. `v4.7.2` to a target framework moniker i.e. `net472`
+func legacyFramework(version string) string {
+	version = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "v")
+	if version == "" {
+		return ""
+	}
+	return "net" + strings.ReplaceAll(version, ".", "")
+}
+
+// loadPackagesConfig reads the packages.config file next to a legacy project. Every package is restored at exactly
+// the version in the file.
+func (p *Project) loadPackagesConfig() error {
+	configPath := filepath.Join(p.dir, "packages.config")
+	contents, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var config packagesConfig
+	if err = xml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("error parsing %s: %v", configPath, err)
+	}
+	for _, pkg := range config.Packages {
+		ref := &PackageReference{Include: pkg.Id}
+		if pkg.Version != "" {
+			ref.Version = fmt.Sprintf("[%s]", pkg.Version)
+		}
+		p.PackagesConfig = append(p.PackagesConfig, ref)
+	}
+	return nil
+}
+
+// isPackageAssembly reports whether a HintPath points into the packages folder that nuget restores packages.config
+// into, i.e. `..\packages\Newtonsoft.Json.13.0.1\lib\net45\Newtonsoft.Json.dll`. Those assemblies come from the
+// package, not from the workspace.
+func (p *Project) isPackageAssembly(hintPath string) bool {
+	parts := strings.Split(strings.ToLower(hintPath), "/")
+	for i, part := range parts {
+		if part != "packages" || i+1 >= len(parts) {
+			continue
+		}
+		for _, ref := range p.PackagesConfig {
+			version := strings.Trim(ref.Version, "[]")
+			if parts[i+1] == strings.ToLower(fmt.Sprintf("%s.%s", ref.Include, version)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetReferences translates Reference items with a HintPath to the references attribute. References without a
+// HintPath are framework assemblies, the SDK provides those.
+func (p *Project) SetReferences() {
+	var refs []bzl.Expr
+	var comments []bzl.Comment
+	for _, ig := range p.ItemGroups {
+		if len(p.Frameworks(&ig.Conditional)) == 0 {
+			continue
+		}
+		for _, ref := range ig.References {
+			if ref.HintPath == "" || len(p.Frameworks(&ig.Conditional, &ref.Conditional)) == 0 {
+				continue
+			}
+			hintPath := forceSlash(p.Evaluate(strings.TrimSpace(ref.HintPath)))
+			if p.isPackageAssembly(hintPath) {
+				continue
+			}
+			messages := ref.Unsupported.Append(ref.ConditionMessages("Reference"), "Reference", true)
+			value, err := p.workspaceFile(hintPath)
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("reference %s %v: %s", ref.Include, err, hintPath))
+				comments = append(comments, util.CommentErrs(messages)...)
+				continue
+			}
+			e := &bzl.StringExpr{Value: value}
+			e.Comment().Before = util.CommentErrs(messages)
+			refs = append(refs, e)
+		}
+	}
+	if expr := util.ListWithComments(refs, comments); expr != nil {
+		p.Rule.SetAttr("references", expr)
+	} else {
+		util.CommentRule(p.Rule, comments)
+	}
+}
+
+// isAbs detects absolute paths on any platform, project files written on windows have drive letters
+func isAbs(p string) bool {
+	return path.IsAbs(p) || len(p) > 1 && p[1] == ':'
+}
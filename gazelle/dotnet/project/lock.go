@@ -0,0 +1,184 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/nuget/consume-packages/package-references-in-project-files#locking-dependencies
+
+const (
+	LockDirect     = "Direct"
+	LockTransitive = "Transitive"
+)
+
+// LockFile follows the format of NuGet's packages.lock.json, but covers every project in the workspace: there is one
+// entry per package per target framework.
+type LockFile struct {
+	Version      int                                  `json:"version"`
+	Dependencies map[string]map[string]*LockedPackage `json:"dependencies"`
+}
+
+type LockedPackage struct {
+	Type string `json:"type"`
+	// Requested is the version range requested by the projects, it is omitted if projects request different ranges
+	Requested   string `json:"requested,omitempty"`
+	Resolved    string `json:"resolved"`
+	ContentHash string `json:"contentHash,omitempty"`
+	// Dependencies are the version ranges of the package's own dependencies
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// NewLockFile records the resolved version of each package for each target framework. Content hashes and
+// dependencies are only known for packages in the feed, feed may be nil. Every package without a content hash is
+// reported in the messages.
+func NewLockFile(packages map[string]*NugetSpec, feed *Feed) (*LockFile, []string) {
+	l := &LockFile{Version: 1, Dependencies: map[string]map[string]*LockedPackage{}}
+	var messages []string
+	for name, spec := range packages {
+		versions, _ := spec.Resolve()
+		for _, v := range versions {
+			var pkg *FeedPackage
+			var hash string
+			if feed != nil {
+				pkg = feed.Find(name, v.Version)
+			}
+			if pkg != nil {
+				var err error
+				if hash, err = pkg.ContentHash(); err != nil {
+					messages = append(messages, fmt.Sprintf("%s/%s: error hashing package: %v", name, v.Version, err))
+				} else if hash == "" {
+					messages = append(messages, fmt.Sprintf("%s/%s: the lock file has no content hash for the package, "+
+						"the nuget feed has neither its .nupkg nor its .nupkg.sha512 file", name, v.Version))
+				}
+			} else {
+				messages = append(messages, fmt.Sprintf("%s/%s: the lock file has no content hash for the package, "+
+					"pass -nuget_feed with a folder that has it, i.e. ~/.nuget/packages", name, v.Version))
+			}
+
+			for tfm := range v.Tfms {
+				locked := &LockedPackage{
+					Type:        LockTransitive,
+					Resolved:    v.Version.String(),
+					ContentHash: hash,
+				}
+				requested := map[string]bool{}
+				for _, r := range spec.Requests {
+					if r.Tfm == tfm && !r.Transitive {
+						locked.Type = LockDirect
+						requested[r.Range.Normalized()] = true
+					}
+				}
+				if len(requested) == 1 {
+					for r := range requested {
+						locked.Requested = r
+					}
+				}
+				if pkg != nil {
+					if framework, ok := ParseFramework(tfm); ok {
+						for _, d := range pkg.Dependencies(framework) {
+							if locked.Dependencies == nil {
+								locked.Dependencies = map[string]string{}
+							}
+							locked.Dependencies[d.Id] = d.Range.Normalized()
+						}
+					}
+				}
+
+				tfmPackages, exists := l.Dependencies[tfm]
+				if !exists {
+					tfmPackages = map[string]*LockedPackage{}
+					l.Dependencies[tfm] = tfmPackages
+				}
+				tfmPackages[name] = locked
+			}
+		}
+	}
+	sort.Strings(messages)
+	return l, messages
+}
+
+// ReadLockFile reads a lock file written by Save
+func ReadLockFile(lockPath string) (*LockFile, error) {
+	contents, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	var l LockFile
+	if err = json.Unmarshal(contents, &l); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", lockPath, err)
+	}
+	return &l, nil
+}
+
+// Save writes the lock file, the output is stable so that it can be checked in and reviewed
+func (l *LockFile) Save(lockPath string) error {
+	contents, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(lockPath, append(contents, '\n'), 0666)
+}
+
+func (l *LockFile) find(tfm, name string) *LockedPackage {
+	tfmPackages := l.Dependencies[tfm]
+	if locked, ok := tfmPackages[name]; ok {
+		return locked
+	}
+	for n, locked := range tfmPackages {
+		if strings.EqualFold(n, name) {
+			return locked
+		}
+	}
+	return nil
+}
+
+// Check compares the packages referenced by projects to the lock file. Each message describes a reference that the
+// lock file doesn't satisfy or a locked package that is no longer referenced.
+func (l *LockFile) Check(packages map[string]*NugetSpec) []string {
+	var messages []string
+	referenced := map[string]map[string]bool{}
+	for name, spec := range packages {
+		for _, r := range spec.Requests {
+			if r.Transitive {
+				continue
+			}
+			if referenced[r.Tfm] == nil {
+				referenced[r.Tfm] = map[string]bool{}
+			}
+			referenced[r.Tfm][strings.ToLower(name)] = true
+
+			locked := l.find(r.Tfm, name)
+			if locked == nil {
+				messages = append(messages, fmt.Sprintf("%s references %s %s for %s, but it is not locked",
+					r.Project, name, r.Range, r.Tfm))
+				continue
+			}
+			v, err := ParseVersion(locked.Resolved)
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("%s is locked for %s at an invalid version: %v", name, r.Tfm, err))
+				continue
+			}
+			if !r.Range.Satisfies(v) {
+				messages = append(messages, fmt.Sprintf("%s references %s %s for %s, but %s is locked",
+					r.Project, name, r.Range, r.Tfm, locked.Resolved))
+			} else if locked.Requested != "" && locked.Requested != r.Range.Normalized() {
+				messages = append(messages, fmt.Sprintf("%s references %s %s for %s, but %s was requested when it was locked",
+					r.Project, name, r.Range, r.Tfm, locked.Requested))
+			}
+		}
+	}
+
+	for tfm, tfmPackages := range l.Dependencies {
+		for name, locked := range tfmPackages {
+			if locked.Type == LockDirect && !referenced[tfm][strings.ToLower(name)] {
+				messages = append(messages, fmt.Sprintf("%s is locked for %s, but no project references it", name, tfm))
+			}
+		}
+	}
+	sort.Strings(messages)
+	return messages
+}
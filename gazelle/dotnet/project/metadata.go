@@ -0,0 +1,175 @@
+package project
+
+import (
+	"encoding/xml"
+	"path"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/common-msbuild-project-items
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/item-element-msbuild#examples
+
+// knownMetadata is item metadata that doesn't change which files are built, so there is nothing to report about it.
+// Names are lower case, msbuild compares them ignoring case.
+var knownMetadata = map[string]bool{
+	"autogen":                true,
+	"copytooutputdirectory":  true,
+	"copytopublishdirectory": true,
+	"customtoolnamespace":    true,
+	"dependentupon":          true,
+	"designtime":             true,
+	"designtimesharedinput":  true,
+	"excludefromsinglefile":  true,
+	"generator":              true,
+	"lastgenoutput":          true,
+	"link":                   true,
+	"linkbase":               true,
+	"logicalname":            true,
+	"manifestresourcename":   true,
+	"pack":                   true,
+	"packagepath":            true,
+	"subtype":                true,
+	"visible":                true,
+	"withculture":            true,
+}
+
+// fileItems returns the items of each type that name files of the project
+var fileItems = []func(ig *ItemGroup) *[]*Item{
+	func(ig *ItemGroup) *[]*Item { return &ig.CompileBefore },
+	func(ig *ItemGroup) *[]*Item { return &ig.Compile },
+	func(ig *ItemGroup) *[]*Item { return &ig.CompileAfter },
+	func(ig *ItemGroup) *[]*Item { return &ig.Content },
+	func(ig *ItemGroup) *[]*Item { return &ig.EmbeddedResources },
+	func(ig *ItemGroup) *[]*Item { return &ig.None },
+}
+
+// parseMetadata moves the attributes and child elements of file items to their Metadata. Only metadata that gazelle
+// doesn't know about is left in Unsupported. Items that include several files, i.e. `a.cs;b.cs`, are split into an
+// item per file so an Update of one of the files doesn't apply to the others.
+func (p *Project) parseMetadata() {
+	for _, ig := range p.ItemGroups {
+		for _, getItems := range fileItems {
+			items := getItems(ig)
+			var split []*Item
+			for _, i := range *items {
+				i.parseMetadata()
+				split = append(split, i.split()...)
+			}
+			*items = split
+		}
+	}
+}
+
+// split returns a copy of the item for each file it includes
+func (i *Item) split() []*Item {
+	includes := splitItems(i.Include)
+	if len(includes) < 2 {
+		return []*Item{i}
+	}
+	items := make([]*Item, len(includes))
+	for n, include := range includes {
+		c := *i
+		c.Include = include
+		c.Metadata = map[string]string{}
+		for k, v := range i.Metadata {
+			c.Metadata[k] = v
+		}
+		if n > 0 {
+			// the item is only reported once
+			c.Unsupported = Unsupported{}
+		}
+		items[n] = &c
+	}
+	return items
+}
+
+func (i *Item) parseMetadata() {
+	i.Metadata = map[string]string{}
+	var attrs []xml.Attr
+	for _, a := range i.UnsupportedAttrs {
+		name := strings.ToLower(a.Name.Local)
+		i.Metadata[name] = a.Value
+		if !knownMetadata[name] {
+			attrs = append(attrs, a)
+		}
+	}
+	var elements []AnyElement
+	for _, e := range i.UnsupportedElements {
+		name := strings.ToLower(e.XMLName.Local)
+		i.Metadata[name] = strings.TrimSpace(e.Value)
+		if !knownMetadata[name] {
+			elements = append(elements, e)
+		}
+	}
+	i.UnsupportedAttrs = attrs
+	i.UnsupportedElements = elements
+}
+
+// Meta returns the value of the metadata name, or an empty string if the item doesn't have it
+func (i *Item) Meta(name string) string {
+	return i.Metadata[strings.ToLower(name)]
+}
+
+// CopiesToOutput is true for items that the build copies to the output directory: `Always`, `PreserveNewest` or
+// `IfDifferent`. An empty value or `Never` leaves the item out of the output.
+func (i *Item) CopiesToOutput() bool {
+	switch strings.ToLower(strings.TrimSpace(i.Meta("CopyToOutputDirectory"))) {
+	case "", "never":
+		return false
+	}
+	return true
+}
+
+// applyUpdates merges the metadata of Update items into the items of the same type that were included before them,
+// the way msbuild evaluates items in document order. Updates that also apply to files that no earlier item lists,
+// i.e. the items the SDK includes by default or a file matched by a glob, are recorded in implicitUpdates.
+func (p *Project) applyUpdates() {
+	for _, getItems := range fileItems {
+		var included []*Item
+		for _, ig := range p.ItemGroups {
+			if len(p.Frameworks(&ig.Conditional)) == 0 {
+				continue
+			}
+			for _, i := range *getItems(ig) {
+				if len(p.Frameworks(&ig.Conditional, &i.Conditional)) == 0 {
+					continue
+				}
+				if i.Update == "" {
+					if i.Include != "" {
+						included = append(included, i)
+					}
+					continue
+				}
+				i.implicitUpdates = nil
+				for _, update := range splitItems(p.Evaluate(Forward(i.Update))) {
+					if !p.updateIncluded(i, update, included) {
+						i.implicitUpdates = append(i.implicitUpdates, update)
+					}
+				}
+			}
+		}
+	}
+}
+
+// updateIncluded merges the metadata of the Update item into the included items that match update, a single file or
+// glob of the item. It reports whether every file update can match was included explicitly before.
+func (p *Project) updateIncluded(i *Item, update string, included []*Item) bool {
+	explicit := false
+	for _, prev := range included {
+		for _, include := range splitItems(p.Evaluate(Forward(prev.Include))) {
+			if strings.Contains(include, "*") {
+				continue
+			}
+			if matched, _ := path.Match(update, include); !matched && update != include {
+				continue
+			}
+			for k, v := range i.Metadata {
+				prev.Metadata[k] = v
+			}
+			if !strings.Contains(update, "*") {
+				explicit = true
+			}
+		}
+	}
+	return explicit
+}
@@ -1,13 +1,14 @@
 package project
 
 import (
-	"encoding/xml"
 	"fmt"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
 	"github.com/bmatcuk/doublestar"
+	"github.com/samhowes/rules_msbuild/gazelle/dotnet/util"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -18,11 +19,108 @@ var variableRegex = regexp.MustCompile(`\$\((\w+)\)`)
 
 type DirectoryInfo struct {
 	Children map[string]*DirectoryInfo
+	Parent   *DirectoryInfo
 	Exts     map[string][]string
 	Base     string
+	// Path is the absolute path to the directory
+	Path     string
 	Project  *Project
 	SrcsMode SrcsMode
 	Protos   []*rule.Rule
+	// Sdks are the SDKs projects in the directory may use, nil for DefaultSdks
+	Sdks map[string]*Sdk
+	// IgnoredProjects, IgnoredPackages and ExcludedDirs are lower case names or patterns of project files, packages and
+	// directories that gazelle skips, see the msbuild_ignore_project, msbuild_ignore_package and msbuild_exclude_dirs
+	// directives
+	IgnoredProjects []string
+	IgnoredPackages []string
+	ExcludedDirs    []string
+	// MaxTestShards is the most shards a test is split into, 0 disables sharding. See the msbuild_test_sharding
+	// directive.
+	MaxTestShards int
+	// ExcludedChildren are the names of the subdirectories that were skipped because of ExcludedDirs
+	ExcludedChildren []string
+}
+
+// DefaultExcludedDirs are never searched for projects or files. The bin and obj directories of projects are skipped
+// separately, see IsProjectOutput.
+var DefaultExcludedDirs = []string{"node_modules"}
+
+// IsProjectOutput reports whether the subdirectory with the name is the bin or obj directory of a project in dir:
+// msbuild writes its outputs next to the project file, a bin or obj directory anywhere else is sources. This is called
+// before the project of dir is loaded, so it checks the files of the directory.
+func (d *DirectoryInfo) IsProjectOutput(name string) bool {
+	if name != "bin" && name != "obj" {
+		return false
+	}
+	entries, err := ioutil.ReadDir(d.Path)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), "proj") {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoresProject reports whether gazelle skips the project file with the name
+func (d *DirectoryInfo) IgnoresProject(name string) bool {
+	return matchesAny(d.IgnoredProjects, name)
+}
+
+// IgnoresPackage reports whether gazelle skips references to the package
+func (d *DirectoryInfo) IgnoresPackage(name string) bool {
+	return d != nil && matchesAny(d.IgnoredPackages, name)
+}
+
+// ExcludesDir reports whether gazelle skips the subdirectory with the name and everything in it
+func (d *DirectoryInfo) ExcludesDir(name string) bool {
+	return matchesAny(d.ExcludedDirs, name)
+}
+
+// AppendNames returns a copy of names with the lower case values that it doesn't contain yet, so that a directive only
+// applies to the directory that declares it and its children
+func AppendNames(names []string, values ...string) []string {
+	lower := make([]string, len(values))
+	for i, v := range values {
+		lower[i] = strings.ToLower(v)
+	}
+	return appendUnique(names, lower...)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched || p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SdkTable returns the SDKs that projects in the directory may use
+func (d *DirectoryInfo) SdkTable() map[string]*Sdk {
+	if d == nil || d.Sdks == nil {
+		return DefaultSdks
+	}
+	return d.Sdks
+}
+
+// FindUp returns the path to the first file named fileName in this directory or any of its parents, the same way
+// msbuild locates Directory.Build.props. An empty string is returned if there is no such file.
+func (d *DirectoryInfo) FindUp(fileName string) string {
+	for dir := d; dir != nil; dir = dir.Parent {
+		if dir.Path == "" {
+			continue
+		}
+		p := filepath.Join(dir.Path, fileName)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
 }
 
 type SrcsMode int
@@ -33,44 +131,110 @@ const (
 	Explicit
 )
 
+// Load parses a project file and evaluates its properties without any of the properties it would inherit from
+// Directory.Build.props, see Evaluator to load a project in the context of its directory
 func Load(projectFile string) (*Project, error) {
-	var proj Project
-	contents, err := ioutil.ReadFile(projectFile)
-	if err != nil {
-		return nil, err
+	return NewEvaluator("").Load(projectFile, nil)
+}
+
+// initialize derives the project attributes from the evaluated properties
+func (p *Project) initialize(projectFile string, sdks map[string]*Sdk) {
+	p.classifySdks(sdks)
+	p.Files = make(map[string]*FileGroup)
+
+	outputType, exists := p.Properties["OutputType"]
+	if exists && (strings.EqualFold(outputType, "exe") || strings.EqualFold(outputType, "winexe")) || p.SdkInfo.IsExe {
+		p.IsExe = true
 	}
-	err = xml.Unmarshal(contents, &proj)
-	if err != nil {
-		return nil, err
+	p.IsTest = p.SdkInfo.IsTest
+
+	p.IsLegacy = p.isLegacy()
+	p.TargetFramework, _ = p.Properties["TargetFramework"]
+	if p.IsLegacy && p.TargetFramework == "" {
+		p.TargetFramework = legacyFramework(p.Properties["TargetFrameworkVersion"])
 	}
+	p.TargetFrameworks = parseFrameworks(p.TargetFramework, p.Properties["TargetFrameworks"])
+	p.AssemblyName, _ = p.Properties["AssemblyName"]
+	p.PackageId, _ = p.Properties["PackageId"]
+	p.ManagePackageVersionsCentrally = strings.EqualFold(p.Properties["ManagePackageVersionsCentrally"], "true")
 
-	proj.LangExt = strings.TrimSuffix(path.Ext(projectFile), "proj")
-	proj.Properties = make(map[string]string)
-	proj.srcsModes = make(map[string]SrcsMode)
+	baseName := filepath.Base(projectFile)
+	p.Ext = path.Ext(baseName)
+	p.Name = baseName[0 : len(baseName)-len(p.Ext)]
+}
 
-	for _, pg := range proj.PropertyGroups {
-		for _, p := range pg.Properties {
-			proj.Properties[p.XMLName.Local] = p.Value
+// parseFrameworks returns the frameworks a project builds for. Just like msbuild, the singular TargetFramework wins
+// over TargetFrameworks when both are specified.
+func parseFrameworks(tfm, tfms string) []string {
+	if tfm != "" {
+		return []string{tfm}
+	}
+	var frameworks []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(tfms, ";") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
 		}
+		seen[f] = true
+		frameworks = append(frameworks, f)
 	}
+	return frameworks
+}
 
-	proj.IsWeb = strings.EqualFold(proj.Sdk, "Microsoft.NET.Sdk.Web")
-	proj.Files = make(map[string]*FileGroup)
+// IsOrdered is true for languages where the order of the sources matters: F# compiles files in the order of the
+// Compile items, a file can only use what is declared in the files before it
+func (p *Project) IsOrdered() bool {
+	return p.LangExt == ".fs"
+}
 
-	outputType, exists := proj.Properties["OutputType"]
-	if exists && strings.EqualFold(outputType, "exe") || proj.IsWeb {
-		proj.IsExe = true
-	}
+// ListsCompileItems is true for projects that only compile the files listed by Compile items: F# and legacy projects
+// don't glob for sources, so neither does gazelle
+func (p *Project) ListsCompileItems() bool {
+	return p.IsLegacy || p.IsOrdered()
+}
 
-	proj.TargetFramework, _ = proj.Properties["TargetFramework"]
-	proj.AssemblyName, _ = proj.Properties["AssemblyName"]
-	proj.PackageId, _ = proj.Properties["PackageId"]
+// IsMultiTargeting is true when the project builds for more than one framework
+func (p *Project) IsMultiTargeting() bool {
+	return len(p.TargetFrameworks) > 1
+}
 
-	baseName := filepath.Base(projectFile)
-	proj.Ext = path.Ext(baseName)
-	proj.Name = baseName[0 : len(baseName)-len(proj.Ext)]
+// Frameworks returns the frameworks for which all of conditions hold. For multi-targeting projects the
+// conditions are evaluated once per framework with $(TargetFramework) set, the same way msbuild evaluates the inner
+// build of each framework. A project without any frameworks is evaluated once and reports the empty framework.
+func (p *Project) Frameworks(conditions ...*Conditional) []string {
+	test := func() bool {
+		for _, c := range conditions {
+			if !c.Test(p, true) {
+				return false
+			}
+		}
+		return true
+	}
+	if !p.IsMultiTargeting() {
+		if test() {
+			if len(p.TargetFrameworks) == 0 {
+				return []string{""}
+			}
+			return p.TargetFrameworks
+		}
+		return nil
+	}
 
-	return &proj, nil
+	original, exists := p.Properties["TargetFramework"]
+	var frameworks []string
+	for _, tfm := range p.TargetFrameworks {
+		p.Properties["TargetFramework"] = tfm
+		if test() {
+			frameworks = append(frameworks, tfm)
+		}
+	}
+	if exists {
+		p.Properties["TargetFramework"] = original
+	} else {
+		delete(p.Properties, "TargetFramework")
+	}
+	return frameworks
 }
 
 func (p *Project) GetFileGroup(key string) *FileGroup {
@@ -89,20 +253,64 @@ func (i *ProjectReference) Evaluate(p *Project) {
 func (i *Item) Evaluate(p *Project) {
 	i.Include = p.Evaluate(Forward(i.Include))
 	i.Exclude = p.Evaluate(Forward(i.Exclude))
-	if i.Condition == "" {
-		i.Remove = p.Evaluate(Forward(i.Remove))
-	} else {
-		i.Remove = ""
-	}
-
+	i.Remove = p.Evaluate(Forward(i.Remove))
+	i.Update = p.Evaluate(Forward(i.Update))
 }
 
-func (r *PackageReference) Evaluate(proj *Project) {
+// Evaluate resolves the name and version of the package reference. When the project manages package versions
+// centrally, the version comes from the PackageVersion items of Directory.Packages.props unless it is overridden.
+// Anything that prevents resolving a version is returned as a message.
+func (r *PackageReference) Evaluate(proj *Project) []string {
 	r.Include = proj.Evaluate(r.Include)
 	if r.Version == "" && r.VersionEl != nil {
 		r.Version = r.VersionEl.Value
 	}
-	r.Version = proj.Evaluate(r.Version)
+	if r.VersionOverride == "" && r.VersionOverrideEl != nil {
+		r.VersionOverride = r.VersionOverrideEl.Value
+	}
+	r.Version = proj.Evaluate(strings.TrimSpace(r.Version))
+	r.VersionOverride = proj.Evaluate(strings.TrimSpace(r.VersionOverride))
+	if r.PrivateAssets == "" && r.PrivateAssetsEl != nil {
+		r.PrivateAssets = r.PrivateAssetsEl.Value
+	}
+	if r.IncludeAssets == "" && r.IncludeAssetsEl != nil {
+		r.IncludeAssets = r.IncludeAssetsEl.Value
+	}
+	if r.ExcludeAssets == "" && r.ExcludeAssetsEl != nil {
+		r.ExcludeAssets = r.ExcludeAssetsEl.Value
+	}
+
+	if !proj.ManagePackageVersionsCentrally {
+		if r.Version == "" {
+			return []string{fmt.Sprintf("no version specified for package %s", r.Include)}
+		}
+		return nil
+	}
+
+	var messages []string
+	if r.Version != "" {
+		// NU1008
+		messages = append(messages, fmt.Sprintf("package %s specifies a Version, but package versions are managed "+
+			"centrally. Use VersionOverride or Directory.Packages.props instead", r.Include))
+	}
+	central, exists := proj.PackageVersions[strings.ToLower(r.Include)]
+	if exists {
+		// package names are case insensitive, use the name from Directory.Packages.props so every project agrees
+		r.Include = central.Include
+	}
+	if r.VersionOverride != "" {
+		r.Version = r.VersionOverride
+		return messages
+	}
+	if exists {
+		r.Version = central.Version
+		return messages
+	}
+	if r.Version == "" {
+		// NU1010
+		messages = append(messages, fmt.Sprintf("no PackageVersion for package %s is defined in Directory.Packages.props", r.Include))
+	}
+	return messages
 }
 
 func (p *Project) Evaluate(s string) string {
@@ -204,28 +412,79 @@ func (p *Project) appendFiles(dir *DirectoryInfo, key, rel, ext string) {
 	}
 }
 
+// appendDefaultFiles adds the files that the SDK includes in items of type key by default
+func (p *Project) appendDefaultFiles(dir *DirectoryInfo, key, rel string, exts []string) {
+	if len(exts) == 0 {
+		return
+	}
+	originalMode, exists := p.srcsModes[key]
+	if !exists || originalMode == Implicit {
+		// do this so we don't have to write an ugly glob that excludes bin, obj, and Properties
+		p.srcsModes[key] = Folders
+	}
+	for _, ext := range exts {
+		p.appendFiles(dir, key, rel, ext)
+	}
+	p.srcsModes[key] = originalMode
+}
+
+func (p *Project) srcsExts() []string {
+	return appendUnique(languages[p.LangExt].Srcs, p.SdkInfo.Srcs...)
+}
+
+// globExcluding globs the sources of a project in implicit mode when it contains excluded directories: the implicit
+// glob of the macro only excludes bin and obj, it would compile the files in the others.
+func (p *Project) globExcluding(dir *DirectoryInfo, key string) {
+	exclude := []string{"bin/**", "obj/**"}
+	for _, d := range excludedChildren(dir, "") {
+		exclude = appendUnique(exclude, d+"/**")
+	}
+	if len(exclude) == 2 {
+		// the macro already excludes bin and obj
+		return
+	}
+	fg := p.GetFileGroup(key)
+	for _, ext := range appendUnique([]string{p.LangExt}, p.srcsExts()...) {
+		fg.IncludeGlob("**/*" + ext)
+	}
+	fg.ExcludeGlobs = util.MakeStringExprs(exclude)
+}
+
+// excludedChildren returns the slash-separated paths of the excluded directories in the directory tree of dir
+func excludedChildren(dir *DirectoryInfo, rel string) []string {
+	var excluded []string
+	for _, name := range dir.ExcludedChildren {
+		excluded = append(excluded, path.Join(rel, name))
+	}
+	for _, c := range dir.Children {
+		excluded = append(excluded, excludedChildren(c, path.Join(rel, c.Base))...)
+	}
+	return excluded
+}
+
 func (p *Project) CollectFiles(dir *DirectoryInfo, rel string) {
 	// https://docs.microsoft.com/en-us/dotnet/core/project-sdk/overview#default-includes-and-excludes
 	// https://github.com/dotnet/AspNetCore.Docs/blob/main/aspnetcore/host-and-deploy/visual-studio-publish-profiles.md#compute-project-items
-	switch rel {
-	case "wwwroot":
-		p.Data = append(p.Data, "wwwroot/**")
-		return
-	case "bin":
-		return
-	case "obj":
-		return
+	for _, d := range p.SdkInfo.Data {
+		if rel == d {
+			p.Data = append(p.Data, d+"/**")
+			return
+		}
 	}
 
 	key := "Compile"
-	if p.srcsModes[key] != Implicit {
+	if p.srcsModes[key] == Implicit {
+		if rel == "" && !p.ListsCompileItems() {
+			p.globExcluding(dir, key)
+		}
+	} else if !p.ListsCompileItems() {
 		// make sure we have an entry so we send `srcs = []` when empty to the macro
 		// to prevent it from implicitly globbing
 		_ = p.GetFileGroup(key)
 
 		p.appendFiles(dir, key, rel, p.LangExt)
-		if p.LangExt == ".cs" {
-			p.appendFiles(dir, key, rel, ".cshtml")
+		for _, ext := range p.srcsExts() {
+			p.appendFiles(dir, key, rel, ext)
 		}
 	}
 
@@ -240,17 +499,10 @@ func (p *Project) CollectFiles(dir *DirectoryInfo, rel string) {
 		p.Protos = append(p.Protos, str)
 	}
 
-	if p.IsWeb {
-		key = "Content"
-		originalMode, exists := p.srcsModes[key]
-		if !exists || originalMode == Implicit {
-			// do this so we don't have to write an ugly glob that excludes bin, obj, and Properties
-			p.srcsModes[key] = Folders
-		}
-		for _, ext := range []string{".json", ".config"} {
-			p.appendFiles(dir, key, rel, ext)
-		}
-		p.srcsModes[key] = originalMode
+	p.appendDefaultFiles(dir, "Content", rel, appendUnique(languages[p.LangExt].Content, p.SdkInfo.Content...))
+	if !p.IsLegacy {
+		// legacy projects list every resource
+		p.appendDefaultFiles(dir, "EmbeddedResource", rel, defaultResources)
 	}
 
 	for _, c := range dir.Children {
@@ -267,9 +519,17 @@ func (p *Project) CollectFiles(dir *DirectoryInfo, rel string) {
 func (p *Project) GetUnsupported() []string {
 	var messages []string
 	messages = p.Unsupported.Append(messages, "project", true)
+	messages = append(messages, p.sdkMessages...)
+	messages = append(messages, p.itemMessages...)
 	for _, pg := range p.PropertyGroups {
+		if !p.isConfigurationCondition(pg.Condition) {
+			messages = append(messages, pg.ConditionMessages("property group")...)
+		}
 		messages = pg.Unsupported.Append(messages, "property group", true)
 		for _, prop := range pg.Properties {
+			if !p.isConfigurationCondition(prop.Condition) {
+				messages = append(messages, prop.ConditionMessages(prop.XMLName.Local)...)
+			}
 			if SpecialProperties[prop.XMLName.Local] {
 				continue
 			}
@@ -277,6 +537,7 @@ func (p *Project) GetUnsupported() []string {
 		}
 	}
 	for _, ig := range p.ItemGroups {
+		messages = append(messages, ig.ConditionMessages("item group")...)
 		messages = ig.Unsupported.Append(messages, "item group", true)
 	}
 	return messages
@@ -2,19 +2,27 @@ package project
 
 import (
 	"encoding/xml"
+	"strings"
+
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
 )
 
 var SpecialProperties = map[string]bool{
-	"TargetFramework": true,
-	"OutputType":      true,
+	"TargetFramework":  true,
+	"TargetFrameworks": true,
+	"OutputType":       true,
 }
 
 type Project struct {
-	XMLName        xml.Name         `xml:"Project"`
-	Sdk            string           `xml:"Sdk,attr"`
+	XMLName xml.Name `xml:"Project"`
+	Sdk     string   `xml:"Sdk,attr"`
+	// ToolsVersion, DefaultTargets and xmlns are only declared by legacy projects, see IsLegacy
+	ToolsVersion   string           `xml:"ToolsVersion,attr"`
+	DefaultTargets string           `xml:"DefaultTargets,attr"`
+	Xmlns          string           `xml:"xmlns,attr"`
+	SdkElements    []*SdkReference  `xml:"Sdk"`
 	PropertyGroups []*PropertyGroup `xml:"PropertyGroup"`
 	ItemGroups     []*ItemGroup     `xml:"ItemGroup"`
 	Imports        []*Import        `xml:"Import"`
@@ -23,13 +31,16 @@ type Project struct {
 	Properties      map[string]string
 	AssemblyName    string
 	TargetFramework string
-	PackageId       string
-	IsExe           bool
-	IsWeb           bool
-	IsTest          bool
-	LangExt         string
-	Files           map[string]*FileGroup
-	Data            []string
+	// TargetFrameworks is every framework the project builds for, it has a single element unless the project is
+	// multi-targeting via the TargetFrameworks property
+	TargetFrameworks []string
+	PackageId        string
+	IsExe            bool
+	IsWeb            bool
+	IsTest           bool
+	LangExt          string
+	Files            map[string]*FileGroup
+	Data             []string
 
 	// Rel is the workspace relative path to the csproj file
 	// Other projects will import this project with this path
@@ -42,16 +53,49 @@ type Project struct {
 	srcsModes map[string]SrcsMode
 	Ext       string
 	Protos    []string
+	// dir is the directory containing the project file, relative paths in conditions are evaluated against it
+	dir string
+	// repoRoot is the absolute path of the workspace, files of other packages are looked up under it
+	repoRoot string
+	// BuildFileNames are the names of the files that make a directory a bazel package, see gazelle's -build_file_name
+	BuildFileNames []string
+	// order is the name of each child element of the project in document order
+	order []string
+	// ManagePackageVersionsCentrally is set when versions of PackageReferences come from Directory.Packages.props
+	ManagePackageVersionsCentrally bool
+	// PackageVersions maps the lower case name of a package to its centrally managed PackageVersion item
+	PackageVersions map[string]*PackageReference
+	// GlobalPackageReferences are referenced by every project that manages package versions centrally
+	GlobalPackageReferences []*PackageReference
+	// IsLegacy is set for projects that don't use an SDK: they list every file explicitly and reference packages
+	// with packages.config
+	IsLegacy bool
+	// PackagesConfig are the packages listed in the packages.config file next to a legacy project
+	PackagesConfig []*PackageReference
+	// SdkInfo combines the SDKs the project uses
+	SdkInfo *Sdk
+	// SdkPackages are referenced implicitly by the SDKs of the project
+	SdkPackages []*PackageReference
+	// TestFramework runs the tests of the project, nil if it isn't known
+	TestFramework *TestFramework
+	sdkMessages   []string
+	// itemMessages describe Update items, they don't produce a file of their own to comment on
+	itemMessages []string
 }
 
 type Import struct {
 	XMLName xml.Name `xml:"Import"`
 	Project string   `xml:"Project,attr"`
+	// Sdk imports a file from an SDK rather than the workspace, i.e. <Import Project="Sdk.props" Sdk="Microsoft.NET.Sdk" />
+	Sdk        string `xml:"Sdk,attr"`
+	SdkVersion string `xml:"Version,attr"`
+	Conditional
 	Unsupported
 }
 
-func (i Import) Evaluate(proj *Project) {
-	i.Project = proj.Evaluate(i.Project)
+func (i *Import) Evaluate(proj *Project) {
+	// $(MSBuildThisFileDirectory) is the directory of the importing file, relative imports are resolved against it anyway
+	i.Project = proj.Evaluate(strings.ReplaceAll(Forward(i.Project), "$(MSBuildThisFileDirectory)", ""))
 }
 
 type FileGroup struct {
@@ -60,8 +104,11 @@ type FileGroup struct {
 	Explicit       []bzl.Expr
 	Globs          []bzl.Expr
 	IncludeGlobs   []bzl.Expr
+	ExcludeGlobs   []bzl.Expr
 	Filters        []string
 	Comments       []bzl.Comment
+	// Ordered are the files and globs of languages that compile their sources in order, in document order
+	Ordered []bzl.Expr
 }
 
 func (fg *FileGroup) IncludeGlob(g string) {
@@ -70,29 +117,58 @@ func (fg *FileGroup) IncludeGlob(g string) {
 
 type PropertyGroup struct {
 	Properties []Property `xml:",any"`
+	Conditional
 	Unsupported
 }
 
 type Property struct {
 	XMLName xml.Name
 	Value   string `xml:",chardata"`
+	Conditional
 	Unsupported
 }
 
 type ItemGroup struct {
-	Compile           []*Item             `xml:"Compile"`
+	Compile []*Item `xml:"Compile"`
+	// CompileBefore and CompileAfter are F# items that are compiled before and after every Compile item
+	CompileBefore     []*Item             `xml:"CompileBefore"`
+	CompileAfter      []*Item             `xml:"CompileAfter"`
 	Content           []*Item             `xml:"Content"`
+	EmbeddedResources []*Item             `xml:"EmbeddedResource"`
 	ProjectReferences []*ProjectReference `xml:"ProjectReference"`
 	PackageReferences []*PackageReference `xml:"PackageReference"`
+	References        []*Reference        `xml:"Reference"`
 	Protobuf          []*Protobuf         `xml:"Protobuf"`
-	// None items are completely ignored
+	// PackageVersion and GlobalPackageReference items are declared in Directory.Packages.props
+	// https://docs.microsoft.com/en-us/nuget/consume-packages/central-package-management
+	PackageVersions         []*PackageReference `xml:"PackageVersion"`
+	GlobalPackageReferences []*PackageReference `xml:"GlobalPackageReference"`
+	// Imports are the namespaces a Visual Basic project imports in every file, they don't affect the build
+	Imports []*Item `xml:"Import"`
+	// None items are only built when they are copied to the output directory
 	None []*Item `xml:"None"`
+	Conditional
 	Unsupported
 }
 
 type ProjectReference struct {
 	XMLName xml.Name
 	Include string `xml:",attr"`
+	// legacy projects record the guid and name of the referenced project, neither is needed to resolve it
+	ProjectGuid string `xml:"Project"`
+	ProjectName string `xml:"Name"`
+	Conditional
+	Unsupported
+}
+
+// Reference is an assembly reference, either to the framework i.e. `System.Xml`, or to a file with HintPath
+type Reference struct {
+	XMLName         xml.Name
+	Include         string `xml:"Include,attr"`
+	HintPath        string `xml:"HintPath"`
+	Private         string `xml:"Private"`
+	SpecificVersion string `xml:"SpecificVersion"`
+	Conditional
 	Unsupported
 }
 
@@ -101,6 +177,19 @@ type PackageReference struct {
 	Include   string   `xml:"Include,attr"`
 	Version   string   `xml:"Version,attr"`
 	VersionEl *Version `xml:"Version"`
+	// VersionOverride replaces the centrally managed version of a package for a single project
+	VersionOverride   string   `xml:"VersionOverride,attr"`
+	VersionOverrideEl *Version `xml:"VersionOverride"`
+	// PrivateAssets, IncludeAssets and ExcludeAssets are `;` separated lists of the assets of the package that flow
+	// to consumers of the project and that the project uses
+	// https://docs.microsoft.com/en-us/nuget/consume-packages/package-references-in-project-files#controlling-dependency-assets
+	PrivateAssets   string   `xml:"PrivateAssets,attr"`
+	PrivateAssetsEl *Version `xml:"PrivateAssets"`
+	IncludeAssets   string   `xml:"IncludeAssets,attr"`
+	IncludeAssetsEl *Version `xml:"IncludeAssets"`
+	ExcludeAssets   string   `xml:"ExcludeAssets,attr"`
+	ExcludeAssetsEl *Version `xml:"ExcludeAssets"`
+	Conditional
 	Unsupported
 }
 
@@ -114,8 +203,14 @@ type Item struct {
 	Include string `xml:"Include,attr"`
 	Exclude string `xml:"Exclude,attr"`
 	// Remove is not directly output to starlark, but is used to filter globbed files
-	Remove    string `xml:"Remove,attr"`
-	Condition string `xml:"Condition,attr"`
+	Remove string `xml:"Remove,attr"`
+	// Update changes the metadata of the items of the same type that were included before it
+	Update string `xml:"Update,attr"`
+	// Metadata are the attributes and child elements of the item keyed by their lower case name, see parseMetadata
+	Metadata map[string]string `xml:"-"`
+	// implicitUpdates are the files and globs of an Update that aren't listed by an earlier item
+	implicitUpdates []string
+	Conditional
 	Unsupported
 }
 
@@ -132,4 +227,5 @@ type Unsupported struct {
 
 type AnyElement struct {
 	XMLName xml.Name
+	Value   string `xml:",chardata"`
 }
@@ -1,96 +1,510 @@
 package project
 
 import (
-	"regexp"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// https://docs.microsoft.com/en-us/nuget/concepts/package-versioning
+
 type NugetSpec struct {
-	Name    string
+	Name string
+	// Requests are all the versions of the package requested by projects, one per project per target framework
+	Requests []*PackageRequest
+}
+
+// PackageRequest is a version range of a package requested by a project for a single target framework. Transitive
+// requests are made by other packages, Project is the id of the requesting package.
+type PackageRequest struct {
+	Project    string
+	Tfm        string
+	Range      *VersionRange
+	Transitive bool `json:",omitempty"`
+}
+
+// ResolvedVersion is a version of a package and the target frameworks it was resolved for
+type ResolvedVersion struct {
 	Version *NugetVer
 	Tfms    map[string]bool
+	// Conflicts describe the frameworks that requested incompatible versions of the package
+	Conflicts []string
 }
 
-type NugetVer struct {
-	numberParts []int
-	suffix      string
-	Raw         string
+// Resolve picks a version of the package for each target framework. A single version is used for every framework
+// when one satisfies all the direct requests. Otherwise, only the requests for the same framework have to agree: one
+// project may pin an older version of a package for net48 than another project uses for net6.0. Transitive requests
+// are only considered for frameworks that don't reference the package directly. Frameworks that resolve to the same
+// version are grouped together, and the versions are returned lowest first.
+//
+// Frameworks that can't be resolved at all are returned as errors.
+func (s *NugetSpec) Resolve() ([]*ResolvedVersion, []string) {
+	byTfm := map[string][]*PackageRequest{}
+	direct := map[string]bool{}
+	var tfms []string
+	var all []*VersionRange
+	for _, r := range s.Requests {
+		if _, exists := byTfm[r.Tfm]; !exists {
+			tfms = append(tfms, r.Tfm)
+		}
+		byTfm[r.Tfm] = append(byTfm[r.Tfm], r)
+		if !r.Transitive {
+			direct[r.Tfm] = true
+			all = append(all, r.Range)
+		}
+	}
+	sort.Strings(tfms)
+
+	var unified *NugetVer
+	if len(all) > 0 {
+		if v, err := Resolve(all); err == nil {
+			unified = v
+		}
+	}
+
+	var resolved []*ResolvedVersion
+	var errs []string
+	versions := map[string]*ResolvedVersion{}
+	for _, tfm := range tfms {
+		var requests []*PackageRequest
+		for _, r := range byTfm[tfm] {
+			// the nearest request wins
+			if !r.Transitive || !direct[tfm] {
+				requests = append(requests, r)
+			}
+		}
+
+		v := unified
+		var err error
+		if v == nil || !direct[tfm] {
+			ranges := make([]*VersionRange, len(requests))
+			for i, r := range requests {
+				ranges[i] = r.Range
+			}
+			v, err = Resolve(ranges)
+			if v == nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", tfm, err))
+				continue
+			}
+		}
+
+		rv, exists := versions[v.String()]
+		if !exists {
+			rv = &ResolvedVersion{Version: v, Tfms: map[string]bool{}}
+			versions[v.String()] = rv
+			resolved = append(resolved, rv)
+		}
+		rv.Tfms[tfm] = true
+		if err != nil {
+			rv.Conflicts = append(rv.Conflicts, fmt.Sprintf("conflicting versions requested for %s: %s, using %s",
+				tfm, joinRequests(requests), v))
+		}
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		return CompareVersions(resolved[i].Version, resolved[j].Version) < 0
+	})
+	return resolved, errs
 }
 
-var versionRegex = regexp.MustCompile(`(\d+\.?)+`)
+func joinRequests(requests []*PackageRequest) string {
+	var parts []string
+	seen := map[string]bool{}
+	for _, r := range requests {
+		p := fmt.Sprintf("%s (%s)", r.Range.Raw, r.Project)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NugetVer is a NuGet package version: a SemVer 2.0 version with an optional fourth (revision) number
+type NugetVer struct {
+	parts    [4]int
+	release  []string
+	metadata string
+	Raw      string
+}
 
-// parseVersion makes a lazy attempt at parsing a probably semver version
-// any number parts are extracted for precise comparison
-// any non-alpha suffix is stored as a raw string and will be alphabetically sorted.
-// suffix comparison is not intended to be accurate, only deterministic
-func ParseVersion(s string) *NugetVer {
+// ParseVersion parses a NuGet version string i.e. `1.0`, `1.2.3.4`, `2.0.0-rc.1+build.5`.
+func ParseVersion(s string) (*NugetVer, error) {
 	v := NugetVer{Raw: s}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.metadata = s[i+1:]
+		s = s[:i]
+		if v.metadata == "" {
+			return nil, fmt.Errorf("invalid version %q: empty build metadata", v.Raw)
+		}
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.release = strings.Split(s[i+1:], ".")
+		s = s[:i]
+		for _, l := range v.release {
+			if l == "" {
+				return nil, fmt.Errorf("invalid version %q: empty release label", v.Raw)
+			}
+		}
+	}
+	numbers := strings.Split(s, ".")
+	if len(numbers) > 4 {
+		return nil, fmt.Errorf("invalid version %q: too many parts", v.Raw)
+	}
+	for i, n := range numbers {
+		p, err := strconv.Atoi(n)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid version %q: %q is not a number", v.Raw, n)
+		}
+		v.parts[i] = p
+	}
+	return &v, nil
+}
+
+// IsPrerelease is true when the version has a release label i.e. `1.0.0-beta`
+func (v *NugetVer) IsPrerelease() bool {
+	return len(v.release) > 0
+}
 
-	match := versionRegex.FindStringIndex(s)
-	if match == nil {
-		v.suffix = s
-		return &v
+// String returns the normalized version: three parts at minimum, the revision only when it is non-zero and no build
+// metadata. `1.0` and `1.0.0.0` are both normalized to `1.0.0`.
+func (v *NugetVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.parts[0], v.parts[1], v.parts[2])
+	if v.parts[3] != 0 {
+		s = fmt.Sprintf("%s.%d", s, v.parts[3])
 	}
+	if v.IsPrerelease() {
+		s = s + "-" + strings.Join(v.release, ".")
+	}
+	return s
+}
 
-	start := match[0]
-	end := match[1] // don't care about other matches, only the leading numbers
-	if start != 0 {
-		v.suffix = s
-		return &v
+// CompareVersions returns -1, 0 or 1 if a is less than, equal to or greater than b using SemVer 2.0 precedence.
+// Build metadata is ignored and release labels are compared case-insensitively, the way NuGet does.
+func CompareVersions(a, b *NugetVer) int {
+	for i := range a.parts {
+		if c := compareInts(a.parts[i], b.parts[i]); c != 0 {
+			return c
+		}
+	}
+	if a.IsPrerelease() != b.IsPrerelease() {
+		// 1.0.0-beta < 1.0.0
+		if a.IsPrerelease() {
+			return -1
+		}
+		return 1
+	}
+	for i := 0; i < len(a.release) && i < len(b.release); i++ {
+		if c := compareLabels(a.release[i], b.release[i]); c != 0 {
+			return c
+		}
 	}
-	numberParts := strings.Split(s[:end], ".")
-	v.numberParts = make([]int, len(numberParts))
-	v.suffix = s[end:]
+	// alpha < alpha.1
+	return compareInts(len(a.release), len(b.release))
+}
 
-	for i, d := range numberParts {
-		n, _ := strconv.Atoi(d)
-		v.numberParts[i] = n
+func compareLabels(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	aNum, bNum := aErr == nil, bErr == nil
+	switch {
+	case aNum && bNum:
+		return compareInts(an, bn)
+	case aNum:
+		// numeric identifiers have lower precedence than alphanumeric identifiers
+		return -1
+	case bNum:
+		return 1
 	}
-	return &v
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
 }
 
-func Best(a *NugetVer, b *NugetVer) *NugetVer {
-	var n int
-	aLen := len(a.numberParts)
-	bLen := len(b.numberParts)
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
 
-	if aLen < bLen {
-		n = aLen
-	} else {
-		n = bLen
+// VersionRange is a NuGet version range: `1.0` (>= 1.0), `[1.0]` (== 1.0), `[1.2,2.0)` or a floating version
+// i.e. `6.*`, `1.0.0-beta*`, or `*`.
+type VersionRange struct {
+	Min          *NugetVer
+	Max          *NugetVer
+	MinInclusive bool
+	MaxInclusive bool
+	float        *floatRange
+	Raw          string
+}
+
+// floatRange is the fixed portion of a floating version: `6.1.*` has the numbers [6, 1]
+type floatRange struct {
+	numbers []int
+	// release is the prefix of the release label for prerelease floats i.e. `beta` for `1.0.0-beta*`
+	release       string
+	floatsRelease bool
+}
+
+// ParseRange parses a NuGet version range
+func ParseRange(s string) (*VersionRange, error) {
+	r := VersionRange{Raw: s}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty version range")
 	}
 
-	for i := 0; i < n; i++ {
-		ap := a.numberParts[i]
-		bp := b.numberParts[i]
-		if ap == bp {
-			continue
+	if s[0] != '[' && s[0] != '(' {
+		if strings.Contains(s, "*") {
+			return parseFloat(s, &r)
 		}
-		if ap > bp {
-			return a
-		} else {
-			return b
+		v, err := ParseVersion(s)
+		if err != nil {
+			return nil, err
 		}
+		// a bare version is a minimum version
+		r.Min, r.MinInclusive = v, true
+		return &r, nil
 	}
 
-	if aLen != bLen {
-		// longest wins
-		if aLen < bLen {
-			return b
-		} else {
-			return a
+	last := s[len(s)-1]
+	if last != ']' && last != ')' {
+		return nil, fmt.Errorf("invalid version range %q: missing closing bracket", r.Raw)
+	}
+	r.MinInclusive = s[0] == '['
+	r.MaxInclusive = last == ']'
+	inner := s[1 : len(s)-1]
+	if strings.Contains(inner, "*") {
+		return nil, fmt.Errorf("invalid version range %q: floating versions are not allowed in brackets", r.Raw)
+	}
+	bounds := strings.Split(inner, ",")
+	var err error
+	switch len(bounds) {
+	case 1:
+		// [1.0] is an exact version
+		if !r.MinInclusive || !r.MaxInclusive {
+			return nil, fmt.Errorf("invalid version range %q: exact versions must be inclusive", r.Raw)
+		}
+		if r.Min, err = ParseVersion(bounds[0]); err != nil {
+			return nil, err
+		}
+		r.Max = r.Min
+	case 2:
+		if min := strings.TrimSpace(bounds[0]); min != "" {
+			if r.Min, err = ParseVersion(min); err != nil {
+				return nil, err
+			}
+		}
+		if max := strings.TrimSpace(bounds[1]); max != "" {
+			if r.Max, err = ParseVersion(max); err != nil {
+				return nil, err
+			}
 		}
+		if r.Min == nil && r.Max == nil {
+			return nil, fmt.Errorf("invalid version range %q: at least one bound is required", r.Raw)
+		}
+		if r.Min != nil && r.Max != nil {
+			c := CompareVersions(r.Min, r.Max)
+			if c > 0 || c == 0 && !(r.MinInclusive && r.MaxInclusive) {
+				return nil, fmt.Errorf("invalid version range %q: no version satisfies it", r.Raw)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid version range %q: too many bounds", r.Raw)
+	}
+	return &r, nil
+}
+
+func parseFloat(s string, r *VersionRange) (*VersionRange, error) {
+	f := floatRange{}
+	numbers := s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		numbers = s[:i]
+		release := s[i+1:]
+		if !strings.HasSuffix(release, "*") || strings.Count(release, "*") != 1 {
+			return nil, fmt.Errorf("invalid floating version %q", r.Raw)
+		}
+		f.release = strings.TrimSuffix(release, "*")
+		f.floatsRelease = true
+	}
+
+	parts := strings.Split(numbers, ".")
+	for i, p := range parts {
+		if p == "*" {
+			if i != len(parts)-1 || f.floatsRelease && f.release != "" {
+				// 1.*.0 and 1.*-beta* are invalid, 1.*-* is fine
+				return nil, fmt.Errorf("invalid floating version %q", r.Raw)
+			}
+			break
+		}
+		if i == len(parts)-1 && !f.floatsRelease {
+			return nil, fmt.Errorf("invalid floating version %q", r.Raw)
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || i > 3 {
+			return nil, fmt.Errorf("invalid floating version %q", r.Raw)
+		}
+		f.numbers = append(f.numbers, n)
+	}
+
+	min := NugetVer{Raw: r.Raw}
+	copy(min.parts[:], f.numbers)
+	if f.floatsRelease && f.release != "" {
+		min.release = strings.Split(f.release, ".")
+		if min.release[len(min.release)-1] == "" {
+			min.release = min.release[:len(min.release)-1]
+		}
+	}
+	if f.floatsRelease && len(min.release) == 0 {
+		// the lowest possible prerelease
+		min.release = []string{"0"}
+	}
+	r.Min, r.MinInclusive = &min, true
+	r.float = &f
+	return r, nil
+}
+
+// ExactRange returns the range `[v]` that is only satisfied by v
+func ExactRange(v *NugetVer) *VersionRange {
+	return &VersionRange{Min: v, Max: v, MinInclusive: true, MaxInclusive: true, Raw: "[" + v.String() + "]"}
+}
+
+// IsFloating is true for ranges like `6.*` that NuGet resolves to the highest matching version on a feed
+func (r *VersionRange) IsFloating() bool {
+	return r.float != nil
+}
+
+// Satisfies reports whether v is within the range
+func (r *VersionRange) Satisfies(v *NugetVer) bool {
+	if r.Min != nil {
+		c := CompareVersions(v, r.Min)
+		if c < 0 || c == 0 && !r.MinInclusive {
+			return false
+		}
+	}
+	if r.Max != nil {
+		c := CompareVersions(v, r.Max)
+		if c > 0 || c == 0 && !r.MaxInclusive {
+			return false
+		}
+	}
+	if r.float == nil {
+		return true
+	}
+	for i, n := range r.float.numbers {
+		if v.parts[i] != n {
+			return false
+		}
+	}
+	if v.IsPrerelease() {
+		return r.float.floatsRelease && strings.HasPrefix(
+			strings.ToLower(strings.Join(v.release, ".")), strings.ToLower(r.float.release))
 	}
-	// i'm not going to try to parse the suffix
-	r := strings.Compare(a.suffix, b.suffix)
-	if r == 0 {
-		return a
+	return true
+}
+
+func (r *VersionRange) String() string {
+	return r.Raw
+}
+
+// Normalized formats the range the way NuGet writes it to lock files, i.e. `1.0` is `[1.0.0, )`
+func (r *VersionRange) Normalized() string {
+	if r.IsFloating() {
+		return r.Raw
 	}
-	// completely arbitrary
-	if r < 0 {
-		return a
+	if r.Min != nil && r.Max != nil && r.MinInclusive && r.MaxInclusive && CompareVersions(r.Min, r.Max) == 0 {
+		return "[" + r.Min.String() + "]"
+	}
+	var b strings.Builder
+	if r.MinInclusive {
+		b.WriteString("[")
 	} else {
-		return b
+		b.WriteString("(")
+	}
+	if r.Min != nil {
+		b.WriteString(r.Min.String())
+	}
+	b.WriteString(", ")
+	if r.Max != nil {
+		b.WriteString(r.Max.String())
+	}
+	if r.MaxInclusive {
+		b.WriteString("]")
+	} else {
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (r *VersionRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Raw)
+}
+
+func (r *VersionRange) UnmarshalJSON(b []byte) error {
+	var raw string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	parsed, err := ParseRange(raw)
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+// Resolve picks a single version for a set of requested ranges. NuGet restores the lowest version that satisfies a
+// range, so the lowest version that satisfies every range is chosen. Gazelle doesn't query a feed: the only
+// candidates are the inclusive lower bounds of the ranges themselves.
+//
+// If no candidate satisfies every range, the highest candidate is returned along with an error describing the
+// conflict. If there are no candidates at all, i.e. only floating ranges were requested, nil is returned with an error.
+func Resolve(ranges []*VersionRange) (*NugetVer, error) {
+	var candidates []*NugetVer
+	for _, r := range ranges {
+		if r.Min != nil && r.MinInclusive && !r.IsFloating() {
+			candidates = append(candidates, r.Min)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("can't pick a version for %s without querying a feed, please specify an exact "+
+			"or minimum version", joinRanges(ranges))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return CompareVersions(candidates[i], candidates[j]) < 0
+	})
+
+	for _, c := range candidates {
+		satisfied := true
+		for _, r := range ranges {
+			if !r.Satisfies(c) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return c, nil
+		}
+	}
+	return candidates[len(candidates)-1], fmt.Errorf("conflicting versions requested: %s", joinRanges(ranges))
+}
+
+func joinRanges(ranges []*VersionRange) string {
+	var raw []string
+	seen := map[string]bool{}
+	for _, r := range ranges {
+		if seen[r.Raw] {
+			continue
+		}
+		seen[r.Raw] = true
+		raw = append(raw, r.Raw)
 	}
+	return strings.Join(raw, ", ")
 }
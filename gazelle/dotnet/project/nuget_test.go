@@ -0,0 +1,251 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustVersion(t *testing.T, s string) *NugetVer {
+	v, err := ParseVersion(s)
+	if err != nil {
+		t.Fatalf("failed to parse version %q: %v", s, err)
+	}
+	return v
+}
+
+func mustRange(t *testing.T, s string) *VersionRange {
+	r, err := ParseRange(s)
+	if err != nil {
+		t.Fatalf("failed to parse range %q: %v", s, err)
+	}
+	return r
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input      string
+		normalized string
+		prerelease bool
+		err        string
+	}{
+		{input: "1.0", normalized: "1.0.0"},
+		{input: "1.2.3", normalized: "1.2.3"},
+		{input: "1.2.3.0", normalized: "1.2.3"},
+		{input: "1.2.3.4", normalized: "1.2.3.4"},
+		{input: " 5.0.0 ", normalized: "5.0.0"},
+		{input: "2.0.0-rc.1+build.5", normalized: "2.0.0-rc.1", prerelease: true},
+		{input: "1.0.0+sha.abc", normalized: "1.0.0"},
+		{input: "", err: "empty version"},
+		{input: "1.0.0+", err: `invalid version "1.0.0+": empty build metadata`},
+		{input: "1.0.0-beta..1", err: `invalid version "1.0.0-beta..1": empty release label`},
+		{input: "1.2.3.4.5", err: `invalid version "1.2.3.4.5": too many parts`},
+		{input: "1.x", err: `invalid version "1.x": "x" is not a number`},
+		{input: "1.0.", err: `invalid version "1.0.": "" is not a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := ParseVersion(tt.input)
+			if tt.err != "" {
+				assert.Nil(t, v)
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.normalized, v.String())
+			assert.Equal(t, tt.prerelease, v.IsPrerelease())
+			assert.Equal(t, tt.input, v.Raw)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.0.1", "1.0.0", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"1.0.0-BETA", "1.0.0-beta", 0},
+		{"1.0.0+a", "1.0.0+b", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, b := mustVersion(t, tt.a), mustVersion(t, tt.b)
+			assert.Equal(t, tt.expected, CompareVersions(a, b))
+			assert.Equal(t, -tt.expected, CompareVersions(b, a))
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input      string
+		normalized string
+		floating   bool
+		err        string
+	}{
+		{input: "1.0", normalized: "[1.0.0, )"},
+		{input: "[1.0]", normalized: "[1.0.0]"},
+		{input: "[1.0,2.0)", normalized: "[1.0.0, 2.0.0)"},
+		{input: "(1.0, 2.0]", normalized: "(1.0.0, 2.0.0]"},
+		{input: "(,2.0]", normalized: "(, 2.0.0]"},
+		{input: "[1.0.0-beta, )", normalized: "[1.0.0-beta, )"},
+		{input: "6.*", normalized: "6.*", floating: true},
+		{input: "*", normalized: "*", floating: true},
+		{input: "1.0.0-beta*", normalized: "1.0.0-beta*", floating: true},
+		{input: "1.*-*", normalized: "1.*-*", floating: true},
+		{input: "", err: "empty version range"},
+		{input: "[1.0", err: `invalid version range "[1.0": missing closing bracket`},
+		{input: "(1.0)", err: `invalid version range "(1.0)": exact versions must be inclusive`},
+		{input: "[1.*, 2.0)", err: `invalid version range "[1.*, 2.0)": floating versions are not allowed in brackets`},
+		{input: "[,]", err: `invalid version range "[,]": at least one bound is required`},
+		{input: "[2.0, 1.0]", err: `invalid version range "[2.0, 1.0]": no version satisfies it`},
+		{input: "(1.0, 1.0]", err: `invalid version range "(1.0, 1.0]": no version satisfies it`},
+		{input: "[1.0, 2.0, 3.0]", err: `invalid version range "[1.0, 2.0, 3.0]": too many bounds`},
+		{input: "1.*.0", err: `invalid floating version "1.*.0"`},
+		{input: "1.*-beta*", err: `invalid floating version "1.*-beta*"`},
+		{input: "1.0.0-beta*.1*", err: `invalid floating version "1.0.0-beta*.1*"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := ParseRange(tt.input)
+			if tt.err != "" {
+				assert.Nil(t, r)
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.normalized, r.Normalized())
+			assert.Equal(t, tt.floating, r.IsFloating())
+		})
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		rng       string
+		satisfied []string
+		rejected  []string
+	}{
+		{
+			rng:       "1.0",
+			satisfied: []string{"1.0.0", "1.0.0.1", "2.0.0", "3.0.0-beta"},
+			rejected:  []string{"0.9.0", "1.0.0-rc.1"},
+		},
+		{
+			rng:       "[1.0]",
+			satisfied: []string{"1.0.0", "1.0.0.0"},
+			rejected:  []string{"1.0.1", "1.0.0-beta"},
+		},
+		{
+			rng:       "(1.0,2.0)",
+			satisfied: []string{"1.0.1", "2.0.0-beta"},
+			rejected:  []string{"1.0.0", "2.0.0"},
+		},
+		{
+			rng:       "[1.0,2.0]",
+			satisfied: []string{"1.0.0", "2.0.0"},
+			rejected:  []string{"2.0.1"},
+		},
+		{
+			rng:       "6.*",
+			satisfied: []string{"6.0.0", "6.12.3"},
+			rejected:  []string{"5.9.0", "7.0.0", "6.1.0-beta"},
+		},
+		{
+			rng:       "6.1.*",
+			satisfied: []string{"6.1.0", "6.1.7"},
+			rejected:  []string{"6.2.0", "6.0.9"},
+		},
+		{
+			rng:       "*",
+			satisfied: []string{"0.0.1", "10.0.0"},
+			rejected:  []string{"1.0.0-beta"},
+		},
+		{
+			rng:       "1.0.0-beta*",
+			satisfied: []string{"1.0.0-beta", "1.0.0-beta.2", "1.0.0-BETA3", "1.0.0"},
+			rejected:  []string{"1.0.0-alpha", "1.0.1", "0.9.0"},
+		},
+		{
+			rng:       "1.*-*",
+			satisfied: []string{"1.0.0-alpha", "1.0.0-0", "1.5.0-rc.1", "1.5.0"},
+			rejected:  []string{"2.0.0-alpha", "2.0.0", "0.9.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			r := mustRange(t, tt.rng)
+			for _, v := range tt.satisfied {
+				assert.True(t, r.Satisfies(mustVersion(t, v)), "%s should satisfy %s", v, tt.rng)
+			}
+			for _, v := range tt.rejected {
+				assert.False(t, r.Satisfies(mustVersion(t, v)), "%s should not satisfy %s", v, tt.rng)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []string
+		expected string
+		err      string
+	}{
+		{name: "single", ranges: []string{"1.0"}, expected: "1.0.0"},
+		{name: "lowest satisfying", ranges: []string{"1.0", "1.2", "[1.0, 2.0)"}, expected: "1.2.0"},
+		{name: "exact", ranges: []string{"1.0", "[1.5]"}, expected: "1.5.0"},
+		{name: "prerelease", ranges: []string{"1.0.0-beta.2", "1.0.0-beta.11"}, expected: "1.0.0-beta.11"},
+		{name: "prerelease is lower", ranges: []string{"1.0.0-rc.1", "1.0.0"}, expected: "1.0.0"},
+		{name: "exclusive lower bound", ranges: []string{"(1.0, )", "[1.0.1, )"}, expected: "1.0.1"},
+		{name: "floating and minimum", ranges: []string{"1.*", "1.2.0"}, expected: "1.2.0"},
+		{
+			name:     "exclusive upper bound",
+			ranges:   []string{"[1.0, 2.0)", "2.0"},
+			expected: "2.0.0",
+			err:      "conflicting versions requested: [1.0, 2.0), 2.0",
+		},
+		{
+			name:     "conflict",
+			ranges:   []string{"[1.0]", "[2.0]", "[1.0]"},
+			expected: "2.0.0",
+			err:      "conflicting versions requested: [1.0], [2.0]",
+		},
+		{
+			name: "floating only",
+			// `1.*-*` has a lower bound, but it is not a candidate since it floats
+			ranges: []string{"1.*-*", "(1.0, )"},
+			err: "can't pick a version for 1.*-*, (1.0, ) without querying a feed, please specify an exact or " +
+				"minimum version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []*VersionRange
+			for _, r := range tt.ranges {
+				ranges = append(ranges, mustRange(t, r))
+			}
+			v, err := Resolve(ranges)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.expected == "" {
+				assert.Nil(t, v)
+				return
+			}
+			assert.Equal(t, tt.expected, v.String())
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/dotnet/core/project-sdk/overview#available-sdks
+// https://docs.microsoft.com/en-us/visualstudio/msbuild/how-to-use-project-sdk
+
+// Sdk describes how projects that use an msbuild SDK are built
+type Sdk struct {
+	Name string
+	// IsExe projects build an executable whatever their OutputType
+	IsExe bool
+	// IsTest projects build a test
+	IsTest bool
+	// Srcs are extensions of files that are compiled in addition to the sources of the project language
+	Srcs []string
+	// Content are extensions of files that are copied to the output
+	Content []string
+	// Data are folders of static files that are available at runtime
+	Data []string
+	// Packages are referenced implicitly by the SDK. Packages without a version are versioned with the SDK i.e.
+	// `MSTest.Sdk/3.3.1`.
+	Packages []*PackageReference
+}
+
+// DefaultSdks are the SDKs that gazelle knows about, keyed by their lower case name. More can be added with the
+// msbuild_sdk directive.
+var DefaultSdks = map[string]*Sdk{}
+
+func init() {
+	web := []string{".json", ".config"}
+	for _, s := range []*Sdk{
+		{Name: "Microsoft.NET.Sdk"},
+		{Name: "Microsoft.NET.Sdk.Web", IsExe: true, Srcs: []string{".razor"}, Content: web, Data: []string{"wwwroot"}},
+		{Name: "Microsoft.NET.Sdk.Razor", Srcs: []string{".razor"}, Data: []string{"wwwroot"}},
+		{Name: "Microsoft.NET.Sdk.BlazorWebAssembly", IsExe: true, Srcs: []string{".razor"}, Content: web, Data: []string{"wwwroot"}},
+		{Name: "Microsoft.NET.Sdk.Worker", IsExe: true, Content: []string{".json"}},
+		{Name: "Microsoft.NET.Sdk.WindowsDesktop", Srcs: []string{".xaml"}},
+		{Name: "MSTest.Sdk", IsTest: true, Packages: []*PackageReference{
+			{Include: "MSTest.TestAdapter"},
+			{Include: "MSTest.TestFramework"},
+		}},
+	} {
+		DefaultSdks[strings.ToLower(s.Name)] = s
+	}
+}
+
+// ParseSdk parses the arguments of an msbuild_sdk directive: the name of the SDK followed by any of
+//   - the name of another SDK to build projects the same way
+//   - `exe` or `test` to set the kind of rule
+//   - `Package/Version` for a package the SDK references
+func ParseSdk(value string, sdks map[string]*Sdk) (*Sdk, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("msbuild_sdk: expected the name of an sdk")
+	}
+	s := &Sdk{Name: fields[0]}
+	for _, f := range fields[1:] {
+		switch {
+		case f == "exe":
+			s.IsExe = true
+		case f == "test":
+			s.IsTest = true
+		case strings.Contains(f, "/"):
+			parts := strings.SplitN(f, "/", 2)
+			s.Packages = append(s.Packages, &PackageReference{Include: parts[0], Version: parts[1]})
+		default:
+			base, exists := sdks[strings.ToLower(f)]
+			if !exists {
+				return nil, fmt.Errorf("msbuild_sdk %s: unknown sdk %s, expected an sdk, exe, test or Package/Version", s.Name, f)
+			}
+			s.merge(base)
+		}
+	}
+	return s, nil
+}
+
+func (s *Sdk) merge(o *Sdk) {
+	s.IsExe = s.IsExe || o.IsExe
+	s.IsTest = s.IsTest || o.IsTest
+	s.Srcs = appendUnique(s.Srcs, o.Srcs...)
+	s.Content = appendUnique(s.Content, o.Content...)
+	s.Data = appendUnique(s.Data, o.Data...)
+	s.Packages = append(s.Packages, o.Packages...)
+}
+
+// appendUnique returns a copy of list with the values that it doesn't contain yet
+func appendUnique(list []string, values ...string) []string {
+	list = append([]string{}, list...)
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// SdkReference is an SDK a project uses, from the Sdk attribute, an Sdk element or the Sdk attribute of an Import
+type SdkReference struct {
+	Name    string `xml:"Name,attr"`
+	Version string `xml:"Version,attr"`
+	Unsupported
+}
+
+// sdkReferences lists the SDKs the project uses, in the order msbuild imports them
+func (p *Project) sdkReferences() []*SdkReference {
+	var refs []*SdkReference
+	add := func(name, version string) {
+		for _, r := range refs {
+			if strings.EqualFold(r.Name, name) {
+				return
+			}
+		}
+		refs = append(refs, &SdkReference{Name: name, Version: version})
+	}
+	// <Project Sdk="Microsoft.NET.Sdk;MSTest.Sdk/3.3.1">
+	for _, s := range strings.Split(p.Sdk, ";") {
+		parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+		if parts[0] == "" {
+			continue
+		}
+		version := ""
+		if len(parts) > 1 {
+			version = parts[1]
+		}
+		add(parts[0], version)
+	}
+	for _, s := range p.SdkElements {
+		add(s.Name, s.Version)
+	}
+	for _, i := range p.Imports {
+		if i.Sdk != "" {
+			add(i.Sdk, i.SdkVersion)
+		}
+	}
+	return refs
+}
+
+// classifySdks derives the kind of the project, the files it builds and its implicit packages from its SDKs
+func (p *Project) classifySdks(sdks map[string]*Sdk) {
+	p.SdkInfo = &Sdk{}
+	for _, ref := range p.sdkReferences() {
+		s, exists := sdks[strings.ToLower(ref.Name)]
+		if !exists {
+			p.sdkMessages = append(p.sdkMessages, fmt.Sprintf("unknown sdk %s, it is built like Microsoft.NET.Sdk. "+
+				"Use the msbuild_sdk directive to describe it", ref.Name))
+			continue
+		}
+		p.SdkInfo.merge(&Sdk{IsExe: s.IsExe, IsTest: s.IsTest, Srcs: s.Srcs, Content: s.Content, Data: s.Data})
+		for _, pkg := range s.Packages {
+			version := pkg.Version
+			if version == "" {
+				version = ref.Version
+			}
+			if version == "" {
+				p.sdkMessages = append(p.sdkMessages, fmt.Sprintf("sdk %s has no version, add it to the Sdk "+
+					"attribute to reference package %s", ref.Name, pkg.Include))
+				continue
+			}
+			p.SdkPackages = append(p.SdkPackages, &PackageReference{Include: pkg.Include, Version: version})
+		}
+		if strings.EqualFold(ref.Name, "Microsoft.NET.Sdk.Web") {
+			p.IsWeb = true
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/visualstudio/extensibility/internals/solution-dot-sln-file
+
+// SolutionFolderType is the project type guid of a solution folder, it groups projects but isn't a project itself
+const SolutionFolderType = "{2150E333-8FDC-42A3-9474-1A3956D46DE8}"
+
+type Solution struct {
+	Name     string
+	Projects []*SolutionProject
+	Folders  []*SolutionProject
+	// Configurations are the solution configurations, i.e. `Debug|Any CPU`
+	Configurations []string
+	byGuid         map[string]*SolutionProject
+}
+
+type SolutionProject struct {
+	TypeGuid string
+	Name     string
+	// Path is relative to the solution file and uses forward slashes
+	Path string
+	Guid string
+	// Folder is the solution folder the project is nested in, if any
+	Folder *SolutionProject
+	// Dependencies are the guids of the projects that must build before this one, in addition to its
+	// ProjectReferences
+	Dependencies []string
+	// Configurations maps a solution configuration to the project configuration it builds
+	Configurations map[string]*ProjectConfiguration
+}
+
+type ProjectConfiguration struct {
+	Configuration string
+	// Build is false if the project isn't built in the solution configuration
+	Build bool
+}
+
+var (
+	slnProject = regexp.MustCompile(`^Project\("(\{[^}]+\})"\)\s*=\s*"([^"]*)",\s*"([^"]*)",\s*"(\{[^}]+\})"`)
+	slnSection = regexp.MustCompile(`^(?:Project|Global)Section\((\w+)\)`)
+	slnSetting = regexp.MustCompile(`^(.*?)\s*=\s*(.*)$`)
+)
+
+// ParseSolution parses a .sln file
+func ParseSolution(slnPath string) (*Solution, error) {
+	file, err := os.Open(slnPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &Solution{
+		Name:   strings.TrimSuffix(path.Base(Forward(slnPath)), path.Ext(slnPath)),
+		byGuid: map[string]*SolutionProject{},
+	}
+	var current *SolutionProject
+	var section string
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case line == "EndProject":
+			current = nil
+		case line == "EndProjectSection" || line == "EndGlobalSection":
+			section = ""
+		case strings.HasPrefix(line, "Project("):
+			m := slnProject.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("%s:%d: invalid project declaration", slnPath, lineNumber)
+			}
+			current = &SolutionProject{
+				TypeGuid:       strings.ToUpper(m[1]),
+				Name:           m[2],
+				Path:           Forward(m[3]),
+				Guid:           strings.ToUpper(m[4]),
+				Configurations: map[string]*ProjectConfiguration{},
+			}
+			s.byGuid[current.Guid] = current
+			if current.TypeGuid == SolutionFolderType {
+				s.Folders = append(s.Folders, current)
+			} else {
+				s.Projects = append(s.Projects, current)
+			}
+		case slnSection.MatchString(line):
+			section = slnSection.FindStringSubmatch(line)[1]
+		default:
+			m := slnSetting.FindStringSubmatch(line)
+			if m == nil || section == "" {
+				continue
+			}
+			s.applySetting(current, section, m[1], m[2])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Solution) applySetting(current *SolutionProject, section, key, value string) {
+	switch section {
+	case "ProjectDependencies":
+		if current != nil {
+			current.Dependencies = append(current.Dependencies, strings.ToUpper(key))
+		}
+	case "SolutionConfigurationPlatforms":
+		s.Configurations = append(s.Configurations, key)
+	case "ProjectConfigurationPlatforms":
+		// {guid}.Debug|Any CPU.ActiveCfg = Debug|Any CPU
+		// {guid}.Debug|Any CPU.Build.0 = Debug|Any CPU
+		i := strings.IndexByte(key, '.')
+		if i < 0 {
+			return
+		}
+		p := s.byGuid[strings.ToUpper(key[:i])]
+		if p == nil {
+			return
+		}
+		rest := key[i+1:]
+		var configuration string
+		var build bool
+		switch {
+		case strings.HasSuffix(rest, ".ActiveCfg"):
+			configuration = strings.TrimSuffix(rest, ".ActiveCfg")
+		case strings.HasSuffix(rest, ".Build.0"):
+			configuration = strings.TrimSuffix(rest, ".Build.0")
+			build = true
+		default:
+			return
+		}
+		c, exists := p.Configurations[configuration]
+		if !exists {
+			c = &ProjectConfiguration{}
+			p.Configurations[configuration] = c
+		}
+		if build {
+			c.Build = true
+		} else {
+			c.Configuration = value
+		}
+	case "NestedProjects":
+		child, parent := s.byGuid[strings.ToUpper(key)], s.byGuid[strings.ToUpper(value)]
+		if child != nil && parent != nil {
+			child.Folder = parent
+		}
+	}
+}
+
+// Project returns the project or solution folder with the guid, or nil
+func (s *Solution) Project(guid string) *SolutionProject {
+	return s.byGuid[strings.ToUpper(guid)]
+}
+
+// IsBuilt reports whether any solution configuration builds the project. Solutions that don't map configurations
+// build every project.
+func (p *SolutionProject) IsBuilt() bool {
+	if len(p.Configurations) == 0 {
+		return true
+	}
+	for _, c := range p.Configurations {
+		if c.Build {
+			return true
+		}
+	}
+	return false
+}
+
+// FolderPath is the path of solution folders the project is nested in, i.e. `src/libs`
+func (p *SolutionProject) FolderPath() string {
+	var parts []string
+	for f := p.Folder; f != nil; f = f.Folder {
+		parts = append([]string{f.Name}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,155 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// https://docs.microsoft.com/en-us/dotnet/core/testing/
+// https://github.com/spekt/junit.testlogger
+
+const (
+	// DefaultTestLogger writes the junit xml that bazel reads, it is a vstest logger
+	DefaultTestLogger = "junit"
+	// DefaultLogPathArgName is the parameter of DefaultTestLogger for the path of the xml file
+	DefaultLogPathArgName = "LogFilePath"
+)
+
+// TestFramework describes how the tests of a framework are run and how they report their results
+type TestFramework struct {
+	Name string
+	// Runners are lower case names of packages that run the tests of the framework, referencing any of them makes the
+	// project a test. Some bring Microsoft.NET.Test.Sdk transitively.
+	Runners []string
+	// Packages are lower case names of the other packages of the framework, a project that only references those is
+	// a library, i.e. shared test utilities
+	Packages []string
+	// Logger and LogPathArgName are passed to `dotnet test` as `--logger <Logger>;<LogPathArgName>=<results file>`
+	Logger         string
+	LogPathArgName string
+}
+
+// TestFrameworks are the test frameworks gazelle recognizes, in order of precedence
+var TestFrameworks = []*TestFramework{
+	{
+		Name:     "xunit",
+		Runners:  []string{"xunit", "xunit.runner.visualstudio", "xunit.v3"},
+		Packages: []string{"xunit.core", "xunit.assert", "xunit.extensibility.core"},
+	},
+	{
+		Name:     "nunit",
+		Runners:  []string{"nunit3testadapter", "nunit.testadapter"},
+		Packages: []string{"nunit"},
+	},
+	{
+		Name:     "mstest",
+		Runners:  []string{"mstest", "mstest.testadapter"},
+		Packages: []string{"mstest.testframework"},
+	},
+	{
+		// TUnit runs on Microsoft.Testing.Platform, which doesn't load vstest loggers. `dotnet test` maps the trx
+		// logger to the trx report of the platform, the launcher writes it to the undeclared outputs since bazel only
+		// reads junit xml.
+		Name:           "tunit",
+		Runners:        []string{"tunit", "tunit.engine"},
+		Packages:       []string{"tunit.core", "tunit.assertions"},
+		Logger:         "trx",
+		LogPathArgName: "LogFileName",
+	},
+}
+
+// testSdkPackage is the vstest host that runs the tests of every vstest framework
+const testSdkPackage = "microsoft.net.test.sdk"
+
+// ClassifyTest decides whether the project is a test and which framework runs it from its IsTestProject property,
+// its SDKs and the names of the packages it references. `<IsTestProject>false</IsTestProject>` wins over everything
+// else.
+func (p *Project) ClassifyTest(packages []string) {
+	referenced := map[string]bool{}
+	for _, pkg := range packages {
+		referenced[strings.ToLower(pkg)] = true
+	}
+
+	for _, f := range TestFrameworks {
+		for _, pkg := range append(f.Runners, f.Packages...) {
+			if referenced[pkg] {
+				p.TestFramework = f
+				break
+			}
+		}
+		if p.TestFramework != nil {
+			break
+		}
+	}
+
+	switch isTestProject := p.Properties["IsTestProject"]; {
+	case strings.EqualFold(isTestProject, "true"):
+		p.IsTest = true
+	case strings.EqualFold(isTestProject, "false"):
+		p.IsTest = false
+	case p.SdkInfo != nil && p.SdkInfo.IsTest, referenced[testSdkPackage]:
+		p.IsTest = true
+	case p.TestFramework != nil:
+		for _, pkg := range p.TestFramework.Runners {
+			if referenced[pkg] {
+				p.IsTest = true
+			}
+		}
+	}
+}
+
+// TestLogger returns the logger and the name of its log path parameter that the tests of the project report their
+// results with
+func (p *Project) TestLogger() (string, string) {
+	if p.TestFramework == nil || p.TestFramework.Logger == "" {
+		return DefaultTestLogger, DefaultLogPathArgName
+	}
+	return p.TestFramework.Logger, p.TestFramework.LogPathArgName
+}
+
+// testAttribute matches the attributes of test methods in C#, F# and Visual Basic: `[Fact]`, `[<Test>]`,
+// `<TestMethod()>` or `[Theory, InlineData(1)]`
+var testAttribute = regexp.MustCompile(`[\[<,]\s*<?\s*(?:\w+\.)*(?:Fact|Theory|Test|TestMethod|DataTestMethod|TestCase)(?:Attribute)?\s*[\]>,(]`)
+
+// CountTests counts the test methods in the sources of the project, it is the most shards the tests can be split into
+func (p *Project) CountTests() int {
+	return p.countTests(p.Directory)
+}
+
+func (p *Project) countTests(dir *DirectoryInfo) int {
+	count := 0
+	for _, f := range dir.Exts[p.LangExt] {
+		contents, err := ioutil.ReadFile(filepath.Join(dir.Path, f))
+		if err != nil {
+			log.Printf("%s: %v", f, err)
+			continue
+		}
+		count += len(testAttribute.FindAll(contents, -1))
+	}
+	for _, c := range dir.Children {
+		if c.Project != nil {
+			continue
+		}
+		count += p.countTests(c)
+	}
+	return count
+}
+
+// ParseTestSharding parses the value of an msbuild_test_sharding directive: `off` or the most shards a test is split
+// into
+func ParseTestSharding(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return 0, nil
+	}
+	shards, err := strconv.Atoi(value)
+	if err != nil || shards < 0 {
+		return 0, fmt.Errorf("msbuild_test_sharding: expected off or a number of shards, got %q", value)
+	}
+	return shards, nil
+}
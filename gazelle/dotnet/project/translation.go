@@ -2,10 +2,15 @@ package project
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/bmatcuk/doublestar"
 	"github.com/samhowes/rules_msbuild/gazelle/dotnet/util"
 )
 
@@ -19,8 +24,31 @@ func (p *Project) GenerateRule(f *rule.File) *rule.Rule {
 		kind = "msbuild_library"
 	}
 
+	p.applyUpdates()
+	if p.IsOrdered() {
+		p.ProcessItemGroup("Compile", func(ig *ItemGroup) []*Item { return ig.CompileBefore })
+	}
 	p.ProcessItemGroup("Compile", func(ig *ItemGroup) []*Item { return ig.Compile })
+	if p.IsOrdered() {
+		p.ProcessItemGroup("Compile", func(ig *ItemGroup) []*Item { return ig.CompileAfter })
+	}
 	p.ProcessItemGroup("Content", func(ig *ItemGroup) []*Item { return ig.Content })
+	p.ProcessItemGroup("EmbeddedResource", func(ig *ItemGroup) []*Item { return ig.EmbeddedResources })
+	// None items that are copied to the output are inputs of the build, like Content items
+	p.ProcessItemGroup("Content", func(ig *ItemGroup) []*Item {
+		var copied []*Item
+		for _, i := range ig.None {
+			// updates that only apply to earlier items were merged into them, but None items include every file by
+			// default: copying one of those adds it to the output
+			if i.CopiesToOutput() && (i.Update == "" || len(i.implicitUpdates) > 0) {
+				copied = append(copied, i)
+			}
+		}
+		return copied
+	})
+	if p.ListsCompileItems() {
+		_ = p.GetFileGroup("Compile")
+	}
 
 	name := p.Name
 	setProjectFile := false
@@ -40,11 +68,28 @@ func (p *Project) GenerateRule(f *rule.File) *rule.Rule {
 	p.CollectFiles(p.Directory, "")
 
 	p.SetFileAttributes()
+	p.SetReferences()
 
 	for _, u := range p.GetUnsupported() {
 		p.Rule.AddComment(util.CommentErr(u))
 	}
 
+	if p.IsTest {
+		if logger, argName := p.TestLogger(); logger != DefaultTestLogger || argName != DefaultLogPathArgName {
+			p.Rule.SetAttr("dotnet_logger", logger)
+			p.Rule.SetAttr("log_path_arg_name", argName)
+		}
+		if p.Directory.MaxTestShards > 1 {
+			shards := p.CountTests()
+			if shards > p.Directory.MaxTestShards {
+				shards = p.Directory.MaxTestShards
+			}
+			if shards > 1 {
+				p.Rule.SetAttr("shard_count", shards)
+			}
+		}
+	}
+
 	if (f == nil || !f.HasDefaultVisibility()) && !p.IsTest {
 		p.Rule.SetAttr("visibility", []string{"//visibility:public"})
 	}
@@ -53,13 +98,17 @@ func (p *Project) GenerateRule(f *rule.File) *rule.Rule {
 		p.Rule.SetAttr("protos", p.Protos)
 	}
 
-	p.Rule.SetAttr("target_framework", p.TargetFramework)
+	if p.IsMultiTargeting() {
+		p.Rule.SetAttr("target_frameworks", p.TargetFrameworks)
+		// the outputs of a project are declared per package, so only one framework is built: the first one, unless
+		// the user keeps another
+		p.Rule.SetAttr("target_framework", p.TargetFrameworks[0])
+	} else {
+		p.Rule.SetAttr("target_framework", p.TargetFramework)
+	}
 	if p.AssemblyName != "" {
 		p.Rule.SetAttr("assembly_name", p.AssemblyName)
 	}
-	if len(p.Data) > 0 {
-		p.Rule.SetAttr("data", util.MakeGlob(util.MakeStringExprs(p.Data), nil))
-	}
 	if p.PackageId != "" {
 		p.Rule.SetAttr("package_id", p.PackageId)
 	}
@@ -91,39 +140,41 @@ func (p *Project) SetProperties() {
 
 func (p *Project) ProcessItemGroup(fgKey string, getItems func(ig *ItemGroup) []*Item) {
 	for _, ig := range p.ItemGroups {
+		if len(p.Frameworks(&ig.Conditional)) == 0 {
+			continue
+		}
 		for _, i := range getItems(ig) {
+			if len(p.Frameworks(&ig.Conditional, &i.Conditional)) == 0 {
+				continue
+			}
 			i.Evaluate(p)
 			itemType := i.XMLName.Local
-			fg := p.GetFileGroup(itemType)
-			comments := util.CommentErrs(i.Unsupported.Messages(itemType, true))
+			messages := i.Unsupported.Append(i.ConditionMessages(itemType), itemType, true)
+			include := forceSlash(i.Include)
+			if i.Update != "" {
+				if itemType != "None" {
+					// the metadata was merged into the items it updates
+					p.itemMessages = append(p.itemMessages, messages...)
+					continue
+				}
+				// the files that were included explicitly got the metadata of the update
+				include = strings.Join(i.implicitUpdates, ";")
+			}
+
+			fg := p.GetFileGroup(fgKey)
 			if i.Remove != "" {
-				fg.Filters = append(fg.Filters, forceSlash(i.Remove))
+				fg.Filters = append(fg.Filters, splitItems(forceSlash(i.Remove))...)
 			}
 
-			if i.Include == "" {
-				fg.Comments = append(fg.Comments, comments...)
+			includes := splitItems(include)
+			if len(includes) == 0 {
+				fg.Comments = append(fg.Comments, util.CommentErrs(messages)...)
 				continue
 			}
-
-			include := forceSlash(i.Include)
-
-			if strings.Contains(include, "*") {
-				if i.Exclude != "" {
-					// Exclude attributes only apply to include attributes on the same element, Exclude on its own
-					// element produces the following error:
-					// MSB4232: items outside Target elements must have one of the following operations: Include, Update, or Remove
-					g := util.MakeGlob(util.MakeStringExprs([]string{include}), util.MakeStringExprs([]string{forceSlash(i.Exclude)}))
-					g.Comment().Before = comments
-					fg.Globs = append(fg.Globs, g)
-				} else {
-					e := &bzl.StringExpr{Value: include}
-					e.Comment().Before = comments
-					fg.IncludeGlobs = append(fg.IncludeGlobs, e)
-				}
-			} else {
-				e := &bzl.StringExpr{Value: include}
-				e.Comment().Before = comments
-				fg.Explicit = append(fg.Explicit, e)
+			for _, include := range includes {
+				p.addInclude(fg, itemType, include, splitItems(forceSlash(i.Exclude)), messages)
+				// the messages describe the whole item, they are reported once
+				messages = nil
 			}
 		}
 	}
@@ -137,19 +188,194 @@ func (p *Project) ProcessItemGroup(fgKey string, getItems func(ig *ItemGroup) []
 	}
 }
 
+// addInclude adds a single file or glob of an item to its file group
+func (p *Project) addInclude(fg *FileGroup, itemType, include string, exclude []string, messages []string) {
+	comments := util.CommentErrs(messages)
+	ordered := p.IsOrdered() && fg.ItemType == "Compile"
+	if strings.Contains(include, "*") {
+		if _, ok := p.packageFile(include); !ok {
+			fg.Comments = append(fg.Comments, util.CommentErrs([]string{fmt.Sprintf(
+				"%s %s is outside of the package, glob it in its own package and reference the files by label",
+				itemType, include)})...)
+			return
+		}
+		if ordered {
+			comments = append(comments, util.CommentErrs([]string{fmt.Sprintf(
+				"%s %s is globbed, the files it matches are compiled in alphabetical order", itemType, include)})...)
+		}
+		if len(exclude) > 0 {
+			// Exclude attributes only apply to include attributes on the same element, Exclude on its own
+			// element produces the following error:
+			// MSB4232: items outside Target elements must have one of the following operations: Include, Update, or Remove
+			g := util.MakeGlob(util.MakeStringExprs([]string{include}), util.MakeStringExprs(exclude))
+			g.Comment().Before = comments
+			if ordered {
+				fg.Ordered = append(fg.Ordered, g)
+			} else {
+				fg.Globs = append(fg.Globs, g)
+			}
+		} else {
+			e := &bzl.StringExpr{Value: include}
+			e.Comment().Before = comments
+			if ordered {
+				fg.Ordered = append(fg.Ordered, util.MakeGlob([]bzl.Expr{e}, nil))
+			} else {
+				fg.IncludeGlobs = append(fg.IncludeGlobs, e)
+			}
+		}
+		return
+	}
+
+	// files outside of the project directory are usually linked into it with Link metadata, bazel
+	// references them by their label
+	value, err := p.workspaceFile(include)
+	if err != nil {
+		fg.Comments = append(fg.Comments, util.CommentErrs(append(messages,
+			fmt.Sprintf("%s %s %v", itemType, include, err)))...)
+		return
+	}
+	e := &bzl.StringExpr{Value: value}
+	e.Comment().Before = comments
+	if ordered {
+		fg.Ordered = append(fg.Ordered, e)
+	} else {
+		fg.Explicit = append(fg.Explicit, e)
+	}
+}
+
+// splitItems splits an item specification into the files and globs it lists, i.e. `a.cs;b.cs`
+func splitItems(spec string) []string {
+	var items []string
+	for _, s := range strings.Split(spec, ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
 func forceSlash(p string) string {
 	return strings.ReplaceAll(p, "\\", "/")
 }
 
+// packageFile converts a path relative to the project file to a path relative to the package of the project. ok is
+// false if the path leaves the package.
+func (p *Project) packageFile(file string) (string, bool) {
+	if isAbs(file) || strings.Contains(file, "$(") {
+		return "", false
+	}
+	rel := path.Join(p.FileLabel.Pkg, file)
+	if p.FileLabel.Pkg == "" {
+		return rel, rel != ".." && !strings.HasPrefix(rel, "../")
+	}
+	if !strings.HasPrefix(rel, p.FileLabel.Pkg+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(rel, p.FileLabel.Pkg+"/"), true
+}
+
+// workspaceFile converts a path relative to the project file to the way the project's package references it: files in
+// the package by their path, files in other packages by the label of their file in the nearest package. An error
+// describes files that can't be referenced: files outside of the workspace, or files their package doesn't export.
+func (p *Project) workspaceFile(file string) (string, error) {
+	if value, ok := p.packageFile(file); ok {
+		return value, nil
+	}
+	rel := path.Join(p.FileLabel.Pkg, file)
+	if isAbs(file) || strings.Contains(file, "$(") || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("is not in the workspace")
+	}
+	dir := path.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+	if p.repoRoot == "" {
+		// without a workspace to look for packages in, assume the file's directory is its package
+		return label.New("", dir, path.Base(rel)).String(), nil
+	}
+	pkg, buildFile := p.enclosingPackage(dir)
+	if buildFile == "" {
+		return "", fmt.Errorf("is not in a bazel package")
+	}
+	name := rel
+	if pkg != "" {
+		name = strings.TrimPrefix(rel, pkg+"/")
+	}
+	if !exportsFile(buildFile, pkg, name) {
+		return "", fmt.Errorf("is not exported, add `exports_files([\"%s\"])` to //%s", name, pkg)
+	}
+	return label.New("", pkg, name).String(), nil
+}
+
+// enclosingPackage finds the nearest directory at or above dir that has a build file. dir and pkg are relative to the
+// workspace, buildFile is the absolute path of the build file or an empty string if there is none.
+func (p *Project) enclosingPackage(dir string) (pkg string, buildFile string) {
+	names := p.BuildFileNames
+	if len(names) == 0 {
+		names = []string{"BUILD.bazel", "BUILD"}
+	}
+	for {
+		for _, name := range names {
+			candidate := filepath.Join(p.repoRoot, filepath.FromSlash(dir), name)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return dir, candidate
+			}
+		}
+		if dir == "" {
+			return "", ""
+		}
+		if dir = path.Dir(dir); dir == "." {
+			dir = ""
+		}
+	}
+}
+
+// exportsFile reports whether an exports_files call in the build file lists name. Lists that aren't literal, i.e.
+// globs, can't be checked and are assumed to export it.
+func exportsFile(buildFile, pkg, name string) bool {
+	f, err := rule.LoadFile(buildFile, pkg)
+	if err != nil {
+		return false
+	}
+	for _, r := range f.Rules {
+		if r.Kind() != "exports_files" || len(r.Args()) == 0 {
+			continue
+		}
+		list, ok := r.Args()[0].(*bzl.ListExpr)
+		if !ok {
+			return true
+		}
+		for _, e := range list.List {
+			if s, ok := e.(*bzl.StringExpr); ok && s.Value == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *Project) SetFileAttributes() {
+	if len(p.Data) > 0 {
+		// the static files of web projects are data
+		fg := p.GetFileGroup("None")
+		fg.IncludeGlobs = append(util.MakeStringExprs(p.Data), fg.IncludeGlobs...)
+	}
 	for _, fg := range p.Files {
+		fg.dropGlobbed()
 		var exprs []bzl.Expr
 		if len(fg.IncludeGlobs) > 0 {
-			exprs = append(exprs, util.MakeGlob(fg.IncludeGlobs, nil))
+			exprs = append(exprs, util.MakeGlob(fg.IncludeGlobs, fg.ExcludeGlobs))
 		}
 		exprs = append(exprs, fg.Globs...)
-		if expr := util.ListWithComments(fg.Explicit, fg.Comments); expr != nil {
+		if fg.ItemType == "Compile" && p.IsOrdered() {
+			segments, comments := orderedSegments(append(fg.Ordered, fg.Explicit...), fg.Comments)
+			exprs = append(exprs, segments...)
+			util.CommentRule(p.Rule, comments)
+		} else if expr := util.ListWithComments(fg.Explicit, fg.Comments); expr != nil {
 			exprs = append(exprs, expr)
+		} else {
+			// there is no file to place the comments on, a placeholder would not be a valid label
+			util.CommentRule(p.Rule, fg.Comments)
 		}
 
 		if len(exprs) <= 0 {
@@ -173,6 +399,10 @@ func (p *Project) SetFileAttributes() {
 			key = "srcs"
 		case "Content":
 			key = "content"
+		case "EmbeddedResource":
+			key = "resources"
+		case "None":
+			key = "data"
 		default:
 			// should not happen
 			p.Rule.AddComment(util.CommentErr(fmt.Sprintf("unkown item type %s please file an issue", fg.ItemType)))
@@ -182,3 +412,52 @@ func (p *Project) SetFileAttributes() {
 	}
 
 }
+
+// dropGlobbed removes the explicit files that are also matched by a glob of the group: bazel doesn't allow a label to
+// be listed twice, i.e. a copied None item that is also a default Content item of a web project.
+func (fg *FileGroup) dropGlobbed() {
+	var explicit []bzl.Expr
+	for _, e := range fg.Explicit {
+		s, ok := e.(*bzl.StringExpr)
+		if ok && fg.isGlobbed(s.Value) {
+			fg.Comments = append(fg.Comments, s.Comment().Before...)
+			continue
+		}
+		explicit = append(explicit, e)
+	}
+	fg.Explicit = explicit
+}
+
+func (fg *FileGroup) isGlobbed(file string) bool {
+	for _, g := range fg.IncludeGlobs {
+		if matched, _ := doublestar.Match(g.(*bzl.StringExpr).Value, file); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedSegments splits the sources of an ordered project into lists of files and globs, keeping the document order:
+// `["a.fs"] + glob(["Generated/*.fs"]) + ["b.fs"]`. The comments are placed in the first list, they are returned when
+// there is no list.
+func orderedSegments(ordered []bzl.Expr, comments []bzl.Comment) ([]bzl.Expr, []bzl.Comment) {
+	var segments []bzl.Expr
+	var files []bzl.Expr
+	flush := func() {
+		if len(files) == 0 {
+			return
+		}
+		segments = append(segments, util.OrderedListWithComments(files, comments))
+		files, comments = nil, nil
+	}
+	for _, e := range ordered {
+		if _, ok := e.(*bzl.StringExpr); ok {
+			files = append(files, e)
+			continue
+		}
+		flush()
+		segments = append(segments, e)
+	}
+	flush()
+	return segments, comments
+}
@@ -52,6 +52,10 @@ type projectDep struct {
 	Comments  []string
 	IsPackage bool
 	IsImport  bool
+	// IsPrivate packages are only used to build the project, they don't flow to its consumers
+	IsPrivate bool
+	// Notes are informational comments on the dep, i.e. the solution folder of a project
+	Notes []string
 }
 
 // Resolve translates imported libraries for a given rule into Bazel
@@ -62,13 +66,15 @@ type projectDep struct {
 // language-specific rules and heuristics.
 func (d *dotnetLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
 	var missing []bzl.Comment
-	var deps []bzl.Expr
+	var deps, privateDeps []bzl.Expr
 	for _, depRaw := range importsRaw.([]interface{}) {
 		dep := depRaw.(*projectDep)
-		comments := make([]bzl.Comment, len(dep.Comments))
-
-		for i, c := range dep.Comments {
-			comments[i] = bzl.Comment{Token: util.CommentErr(c)}
+		var comments []bzl.Comment
+		for _, n := range dep.Notes {
+			comments = append(comments, bzl.Comment{Token: "# " + n})
+		}
+		for _, c := range dep.Comments {
+			comments = append(comments, bzl.Comment{Token: util.CommentErr(c)})
 		}
 		l, comments := findDep(c, ix, dep, comments, from)
 
@@ -84,12 +90,21 @@ func (d *dotnetLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.R
 				Value:    l.String(),
 				Comments: bzl.Comments{Before: comments},
 			}
-			deps = append(deps, &dExpr)
+			if dep.IsPrivate {
+				privateDeps = append(privateDeps, &dExpr)
+			} else {
+				deps = append(deps, &dExpr)
+			}
 		}
 	}
 
 	if expr := util.ListWithComments(deps, missing); expr != nil {
 		r.SetAttr("deps", expr)
+	} else {
+		util.CommentRule(r, missing)
+	}
+	if expr := util.ListWithComments(privateDeps, nil); expr != nil {
+		r.SetAttr("private_deps", expr)
 	}
 }
 
@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace nobuildfiles
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1 @@
+module Args
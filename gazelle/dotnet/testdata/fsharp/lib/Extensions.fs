@@ -0,0 +1 @@
+module M
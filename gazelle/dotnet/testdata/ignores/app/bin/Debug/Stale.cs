@@ -0,0 +1,6 @@
+namespace app
+{
+    public class Stale
+    {
+    }
+}
@@ -0,0 +1,6 @@
+namespace app.tools.bin
+{
+    public class Wrapper
+    {
+    }
+}
@@ -0,0 +1,6 @@
+namespace lib
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1,7 @@
+namespace lib
+{
+    // a stale output of a local build
+    public class Stale
+    {
+    }
+}
@@ -0,0 +1,7 @@
+namespace lib.scratch
+{
+    // work in progress, not part of the build
+    public class Scratch
+    {
+    }
+}
@@ -0,0 +1,6 @@
+namespace lib.sub
+{
+    public static class Helper
+    {
+    }
+}
@@ -0,0 +1 @@
+class Program { static void Main() {} }
@@ -0,0 +1 @@
+[assembly: System.Reflection.AssemblyTitle("app")]
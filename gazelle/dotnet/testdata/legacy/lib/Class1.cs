@@ -0,0 +1 @@
+public class Class1 {}
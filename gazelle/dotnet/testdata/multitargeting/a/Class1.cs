@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace a
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace b
+{
+    public class Class1
+    {
+    }
+}
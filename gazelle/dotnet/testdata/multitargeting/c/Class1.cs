@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace c
+{
+    public class Class1
+    {
+    }
+}
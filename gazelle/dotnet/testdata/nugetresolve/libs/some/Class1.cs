@@ -0,0 +1,6 @@
+namespace Some
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace d
+{
+    public class Class1
+    {
+    }
+}
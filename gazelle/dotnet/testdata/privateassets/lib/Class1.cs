@@ -0,0 +1,6 @@
+namespace privateassets
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1,9 @@
+namespace app
+{
+    public class Program
+    {
+        public static void Main(string[] args)
+        {
+        }
+    }
+}
@@ -0,0 +1,12 @@
+﻿using System;
+
+namespace binary
+{
+    class Program
+    {
+        static void Main(string[] args)
+        {
+            Console.WriteLine("Hello World!");
+        }
+    }
+}
@@ -0,0 +1,8 @@
+﻿using System;
+
+namespace lib
+{
+    public class Class1
+    {
+    }
+}
@@ -0,0 +1,6 @@
+namespace istestproject
+{
+    public class Tests
+    {
+    }
+}
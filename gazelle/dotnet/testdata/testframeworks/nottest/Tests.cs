@@ -0,0 +1,6 @@
+namespace nottest
+{
+    public class Tests
+    {
+    }
+}
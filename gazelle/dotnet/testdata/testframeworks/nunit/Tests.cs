@@ -0,0 +1,6 @@
+namespace nunit
+{
+    public class Tests
+    {
+    }
+}
@@ -0,0 +1,6 @@
+namespace testutils
+{
+    public class Tests
+    {
+    }
+}
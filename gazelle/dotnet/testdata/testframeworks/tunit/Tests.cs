@@ -0,0 +1,6 @@
+namespace tunit
+{
+    public class Tests
+    {
+    }
+}
@@ -0,0 +1,16 @@
+using Xunit;
+
+namespace big.Integration
+{
+    public class DatabaseTests
+    {
+        [Fact]
+        public void Connects() { }
+
+        [Fact(Skip = "flaky")]
+        public void Migrates() { }
+
+        [Xunit.Fact]
+        public void Queries() { }
+    }
+}
@@ -0,0 +1,13 @@
+using Xunit;
+
+namespace off
+{
+    public class UnitTests
+    {
+        [Fact]
+        public void Adds() { }
+
+        [Theory, InlineData(1)]
+        public void Subtracts(int value) { }
+    }
+}
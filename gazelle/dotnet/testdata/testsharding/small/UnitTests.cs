@@ -0,0 +1,10 @@
+using Xunit;
+
+namespace small
+{
+    public class UnitTests
+    {
+        [Fact]
+        public void Adds() { }
+    }
+}
@@ -3,6 +3,7 @@ package dotnet
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	bzl "github.com/bazelbuild/buildtools/build"
 	"io/ioutil"
@@ -17,61 +18,159 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/samhowes/rules_msbuild/gazelle/dotnet/project"
+	"github.com/samhowes/rules_msbuild/gazelle/dotnet/util"
 )
 
-// RepoUpdater may be implemented by languages that support updating
-// repository rules that provide named libraries.
+// UpdateRepos adds or updates packages in the `nuget_fetch` rule of the -deps_macro file. Imports are package ids
+// with a version or version range: `gazelle update-repos Newtonsoft.Json@13.0.1`.
 //
-// EXPERIMENTAL: this may change or be removed.
+// Packages that are already fetched keep their target frameworks, new packages are fetched for every target
+// framework of the `nuget_fetch` rule.
 func (d *dotnetLang) UpdateRepos(args language.UpdateReposArgs) language.UpdateReposResult {
-	log.Panicf("update repo!")
-	return language.UpdateReposResult{}
+	res := language.UpdateReposResult{}
+	dc := getConfig(args.Config)
+	f, err := loadMacroFile(dc, args.Config)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	packages, frameworks := loadFetchedPackages(f)
+	for _, imp := range args.Imports {
+		name, r, err := parsePackageArg(imp)
+		if err != nil {
+			res.Error = err
+			return res
+		}
+
+		var tfms []string
+		existing := project.FindSpec(packages, name)
+		if existing != nil {
+			name = existing.Name
+			seen := map[string]bool{}
+			for _, req := range existing.Requests {
+				if !seen[req.Tfm] {
+					seen[req.Tfm] = true
+					tfms = append(tfms, req.Tfm)
+				}
+			}
+		} else {
+			for tfm := range frameworks {
+				tfms = append(tfms, tfm)
+			}
+			sort.Strings(tfms)
+		}
+		if len(tfms) == 0 {
+			res.Error = fmt.Errorf("%s: no target frameworks are known yet, run `gazelle update` first", imp)
+			return res
+		}
+
+		spec := &project.NugetSpec{Name: name}
+		for _, tfm := range tfms {
+			spec.Requests = append(spec.Requests, &project.PackageRequest{Project: "update-repos", Tfm: tfm, Range: r})
+		}
+		packages[name] = spec
+	}
+
+	res.Error = updateMacro(args.Config, f, packages, frameworks, false)
+	return res
 }
 
-// ImportRepos generates a list of repository rules by reading a
-// configuration file from another build system.
+// ImportRepos updates the `nuget_fetch` rule of the -deps_macro file from a package report. Packages in the report
+// replace the packages of the same name, with -prune packages that aren't in the report are removed.
 func (d *dotnetLang) ImportRepos(args language.ImportReposArgs) language.ImportReposResult {
-	var packages map[string]*project.NugetSpec
+	var report map[string]*project.NugetSpec
 	res := language.ImportReposResult{}
 	c, err := os.ReadFile(args.Path)
 	res.Error = err
 	if res.Error == nil {
-		res.Error = json.Unmarshal(c, &packages)
+		res.Error = json.Unmarshal(c, &report)
 	}
 	if res.Error != nil {
 		return res
 	}
 
-	res, _ = importReposImpl(packages, nil, nil, language.GenerateArgs{})
-	return res
+	dc := getConfig(args.Config)
+	f, err := loadMacroFile(dc, args.Config)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	packages, frameworks := loadFetchedPackages(f)
+	if args.Prune {
+		packages = map[string]*project.NugetSpec{}
+	}
+	for name, spec := range report {
+		if existing := project.FindSpec(packages, name); existing != nil {
+			delete(packages, existing.Name)
+		}
+		if spec.Name == "" {
+			spec.Name = name
+		}
+		for _, req := range spec.Requests {
+			frameworks[req.Tfm] = true
+		}
+		packages[spec.Name] = spec
+	}
 
+	res.Error = updateMacro(args.Config, f, packages, frameworks, false)
+	return res
 }
 
 func (d *dotnetLang) customUpdateRepos(args language.GenerateArgs) {
 	dc := getConfig(args.Config)
-	var macroPath string
-	if dc.macroFileName != "" {
-		macroPath = strings.Replace(dc.macroFileName, ":", "/", -1)
-		macroPath = filepath.Join(args.Config.RepoRoot, filepath.Clean(macroPath))
+	if dc.mode == "diff" {
+		checkLockFile(dc, args.Config)
+		return
+	}
+	f, err := loadMacroFile(dc, args.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = updateMacro(args.Config, f, dc.packages, dc.frameworks, true); err != nil {
+		log.Fatal(err)
 	}
+}
 
+// loadMacroFile loads the -deps_macro file, or creates an empty one if it doesn't exist yet
+func loadMacroFile(dc *dotnetConfig, c *config.Config) (*rule.File, error) {
+	if dc.macroFileName == "" {
+		return nil, fmt.Errorf("-deps_macro is required to manage nuget packages")
+	}
+	macroPath := dc.macroPath(c)
 	f, err := rule.LoadMacroFile(macroPath, "", dc.macroDefName)
 	if os.IsNotExist(err) {
 		directory := filepath.Dir(macroPath)
 		if err = os.MkdirAll(directory, os.ModePerm); err != nil {
-			log.Fatalf("error creating directory %s: %v", directory, err)
+			return nil, fmt.Errorf("error creating directory %s: %v", directory, err)
 		}
 
 		f, err = rule.EmptyMacroFile(macroPath, "", dc.macroDefName)
 		if err != nil {
-			log.Fatalf("error creating %s: %v", macroPath, err)
+			return nil, fmt.Errorf("error creating %s: %v", macroPath, err)
 		}
 	} else if err != nil {
-		log.Fatalf("error loading %q: %v", macroPath, err)
+		return nil, fmt.Errorf("error loading %q: %v", macroPath, err)
 	}
+	return f, nil
+}
 
-	res, loads := importReposImpl(dc.packages, dc.frameworks, f, args)
-	match, err := merger.Match(f.Rules, res.Gen[0], kinds["nuget_fetch"])
+// updateMacro replaces the `nuget_fetch` rule in the macro file with one that fetches packages and saves the file.
+//
+// When fixWorkspace is set, a call to the macro is added to WORKSPACE. `update-repos` rewrites WORKSPACE itself after
+// the languages are done, so the call can only be reported there.
+func updateMacro(c *config.Config, f *rule.File, packages map[string]*project.NugetSpec, frameworks map[string]bool, fixWorkspace bool) error {
+	dc := getConfig(c)
+	if dc.feed != nil {
+		var messages []string
+		packages, messages = dc.feed.Closure(packages)
+		for _, m := range messages {
+			log.Print(m)
+		}
+	}
+	res, loads := importReposImpl(packages, frameworks, f, c)
+	match, _ := merger.Match(f.Rules, res.Gen[0], kinds["nuget_fetch"])
 	if match != nil {
 		// apparently the default code doesn't like merging our dictionary of lists
 		// we'll do this manually
@@ -85,22 +184,123 @@ func (d *dotnetLang) customUpdateRepos(args language.GenerateArgs) {
 	f.Sync()
 	f.SortMacro()
 	if err := f.Save(f.Path); err != nil {
-		log.Fatalf("error saving %s: %v", f.Path, err)
+		return fmt.Errorf("error saving %s: %v", f.Path, err)
 	}
 
-	workspace, err := rule.LoadWorkspaceFile(filepath.Join(args.Config.RepoRoot, "WORKSPACE"), "")
+	lock, messages := project.NewLockFile(packages, dc.feed)
+	for _, m := range messages {
+		log.Print(m)
+	}
+	if err := lock.Save(dc.lockFilePath(c)); err != nil {
+		return fmt.Errorf("error saving the nuget lock file: %v", err)
+	}
+
+	workspace, err := rule.LoadWorkspaceFile(filepath.Join(c.RepoRoot, "WORKSPACE"), "")
 	if err != nil {
-		log.Fatalf("error loading WORKSPACE: %v", err)
+		return fmt.Errorf("error loading WORKSPACE: %v", err)
 	}
 
 	workspaceIndex := len(workspace.Loads) + len(workspace.Rules)
 	if ensureMacroInWorkspace(dc, workspace, workspaceIndex) {
+		if !fixWorkspace {
+			log.Printf("%s%%%s is not called from WORKSPACE, run `gazelle update` to add it", dc.macroFileName, dc.macroDefName)
+			return nil
+		}
 		workspace.Sync()
 
 		if err := workspace.Save(workspace.Path); err != nil {
-			log.Fatalf("error saving %s: %v", workspace.Path, err)
+			return fmt.Errorf("error saving %s: %v", workspace.Path, err)
+		}
+	}
+	return nil
+}
+
+// checkLockFile fails if the packages referenced by the projects in the workspace have drifted from the lock file.
+// With -mode=diff nothing is written, so CI can catch the drift before packages are restored.
+func checkLockFile(dc *dotnetConfig, c *config.Config) {
+	lockPath := dc.lockFilePath(c)
+	lock, err := project.ReadLockFile(lockPath)
+	if err != nil {
+		log.Fatalf("error reading the nuget lock file, run `gazelle update` to create it: %v", err)
+	}
+	messages := lock.Check(dc.packages)
+	for _, m := range messages {
+		log.Print(m)
+	}
+	if len(messages) > 0 {
+		rel, _ := filepath.Rel(c.RepoRoot, lockPath)
+		log.Fatalf("%s is out of date, run `gazelle update` to update it", filepath.ToSlash(rel))
+	}
+}
+
+// parsePackageArg parses an `update-repos` argument in the form `Name@Version`
+func parsePackageArg(arg string) (string, *project.VersionRange, error) {
+	i := strings.LastIndexByte(arg, '@')
+	if i <= 0 || i == len(arg)-1 {
+		return "", nil, fmt.Errorf("%s: expected a package and version in the form `Name@Version`", arg)
+	}
+	r, err := project.ParseRange(arg[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", arg, err)
+	}
+	return arg[:i], r, nil
+}
+
+// loadFetchedPackages reads the packages and target frameworks of the `nuget_fetch` rule in the macro file. Each
+// fetched version is an exact request for the frameworks it is fetched for.
+func loadFetchedPackages(f *rule.File) (map[string]*project.NugetSpec, map[string]bool) {
+	packages := map[string]*project.NugetSpec{}
+	frameworks := map[string]bool{}
+	var r *rule.Rule
+	for _, e := range f.Rules {
+		if e.Kind() == "nuget_fetch" {
+			r = e
+			break
+		}
+	}
+	if r == nil {
+		return packages, frameworks
+	}
+	migrateNugetFetch(r, true)
+
+	for _, tfm := range r.AttrStrings("target_frameworks") {
+		frameworks[tfm] = true
+	}
+	dict, ok := r.Attr("packages").(*bzl.DictExpr)
+	if !ok {
+		return packages, frameworks
+	}
+	for _, kv := range dict.List {
+		key, ok := kv.Key.(*bzl.StringExpr)
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(key.Value, "/", 2)
+		if len(parts) != 2 {
+			log.Printf("%s: expected a package id in the form `Name/Version`", key.Value)
+			continue
+		}
+		v, err := project.ParseRange("[" + parts[1] + "]")
+		if err != nil {
+			log.Printf("%s: %v", key.Value, err)
+			continue
+		}
+		spec, exists := packages[parts[0]]
+		if !exists {
+			spec = &project.NugetSpec{Name: parts[0]}
+			packages[parts[0]] = spec
+		}
+		tfms, _ := kv.Value.(*bzl.ListExpr)
+		if tfms == nil {
+			continue
+		}
+		for _, t := range tfms.List {
+			if tfm, ok := t.(*bzl.StringExpr); ok {
+				spec.Requests = append(spec.Requests, &project.PackageRequest{Project: "nuget_fetch", Tfm: tfm.Value, Range: v})
+			}
 		}
 	}
+	return packages, frameworks
 }
 
 func fixLoads(f *rule.File, loads []*rule.Load) {
@@ -204,7 +404,7 @@ func ensureMacroInWorkspace(uc *dotnetConfig, workspace *rule.File, insertIndex
 	return true
 }
 
-func importReposImpl(packages map[string]*project.NugetSpec, frameworks map[string]bool, f *rule.File, args language.GenerateArgs) (language.ImportReposResult, []*rule.Load) {
+func importReposImpl(packages map[string]*project.NugetSpec, frameworks map[string]bool, f *rule.File, c *config.Config) (language.ImportReposResult, []*rule.Load) {
 	var r *rule.Rule
 	for _, e := range f.Rules {
 		if e.Kind() == "nuget_fetch" {
@@ -224,36 +424,46 @@ func importReposImpl(packages map[string]*project.NugetSpec, frameworks map[stri
 		}
 	}
 
-	pkg := filepath.Dir(f.Path[len(args.Dir)+1:])
+	pkg := filepath.Dir(f.Path[len(c.RepoRoot)+1:])
 	if filepath.Separator == '\\' {
 		pkg = strings.ReplaceAll(pkg, "\\", "/")
 	}
 	deps := r.Attr("deps")
 	var publicDeps map[string]map[string]bool
 	if deps != nil {
-		publicDeps = loadReferencedPackages(deps, loaded, args, pkg)
+		publicDeps = loadReferencedPackages(deps, loaded, c, pkg)
 	} else {
 		publicDeps = map[string]map[string]bool{}
 	}
 
 	packagesMap := map[string]map[string]bool{}
+	pkgErrs := map[string][]string{}
 	var pkgIds []string
 	for pkgName, nuspec := range packages {
-		pkgId := fmt.Sprintf("%s/%s", pkgName, nuspec.Version.Raw)
-		var tfms map[string]bool
-		tfms, ok := publicDeps[pkgId]
-		if !ok {
-			tfms, ok = packagesMap[pkgId]
-			pkgIds = append(pkgIds, pkgId)
+		versions, errs := nuspec.Resolve()
+		for _, e := range errs {
+			log.Printf("%s: %s", pkgName, e)
+		}
+		for _, v := range versions {
+			pkgId := fmt.Sprintf("%s/%s", pkgName, v.Version.String())
+			for _, c := range v.Conflicts {
+				log.Printf("%s: %s", pkgName, c)
+				pkgErrs[pkgId] = append(pkgErrs[pkgId], fmt.Sprintf("%s: %s", pkgName, c))
+			}
+			tfms, ok := publicDeps[pkgId]
 			if !ok {
-				tfms = map[string]bool{}
-				packagesMap[pkgId] = tfms
+				tfms, ok = packagesMap[pkgId]
+				pkgIds = append(pkgIds, pkgId)
+				if !ok {
+					tfms = map[string]bool{}
+					packagesMap[pkgId] = tfms
+				}
 			}
-		}
 
-		for tfm, used := range nuspec.Tfms {
-			if used {
-				tfms[tfm] = true
+			for tfm, used := range v.Tfms {
+				if used {
+					tfms[tfm] = true
+				}
 			}
 		}
 	}
@@ -273,10 +483,12 @@ func importReposImpl(packages map[string]*project.NugetSpec, frameworks map[stri
 		for _, tfm := range tfms {
 			tfmsExpr = append(tfmsExpr, &bzl.StringExpr{Value: tfm})
 		}
-		packagesExpr = append(packagesExpr, &bzl.KeyValueExpr{
+		kv := &bzl.KeyValueExpr{
 			Key:   &bzl.StringExpr{Value: pkgId},
 			Value: &bzl.ListExpr{List: tfmsExpr},
-		})
+		}
+		kv.Comments.Before = util.CommentErrs(pkgErrs[pkgId])
+		packagesExpr = append(packagesExpr, kv)
 	}
 	r.SetAttr("packages", &bzl.DictExpr{List: packagesExpr, ForceMultiLine: true})
 
@@ -314,7 +526,7 @@ func importReposImpl(packages map[string]*project.NugetSpec, frameworks map[stri
 	return res, loads
 }
 
-func loadReferencedPackages(deps bzl.Expr, loaded map[string]string, args language.GenerateArgs, pkg string) map[string]map[string]bool {
+func loadReferencedPackages(deps bzl.Expr, loaded map[string]string, c *config.Config, pkg string) map[string]map[string]bool {
 	var calls []*bzl.CallExpr
 	switch t := deps.(type) {
 	default:
@@ -344,7 +556,7 @@ func loadReferencedPackages(deps bzl.Expr, loaded map[string]string, args langua
 			continue
 		}
 
-		if l.Repo != args.Config.RepoName {
+		if l.Repo != c.RepoName {
 			continue
 		}
 
@@ -352,7 +564,7 @@ func loadReferencedPackages(deps bzl.Expr, loaded map[string]string, args langua
 			l.Pkg = pkg
 		}
 
-		fPath := filepath.Join(args.Config.RepoRoot, l.Pkg, l.Name)
+		fPath := filepath.Join(c.RepoRoot, l.Pkg, l.Name)
 		content, err := ioutil.ReadFile(fPath)
 		if err != nil {
 			log.Printf("error loading %s: %v", l, err)
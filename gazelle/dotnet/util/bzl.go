@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
 	"sort"
 	"strings"
@@ -64,22 +65,52 @@ func SortExprs(exprs []bzl.Expr) []bzl.Expr {
 }
 
 // ListWithComments creates a bzl.ListExpr with value of list
-// if both list and comments are empty, nil is returned
-// if list is empty, an empty list is rendered that contains comments
+// if list is empty, nil is returned: an empty list doesn't print its comments, see CommentRule
 // if list is non-empty, comments are placed at the beginning of the list
 func ListWithComments(list []bzl.Expr, comments []bzl.Comment) *bzl.ListExpr {
-	if len(list) == 0 && len(comments) == 0 {
+	return listWithComments(list, comments, true)
+}
+
+// OrderedListWithComments is ListWithComments for lists where the order matters, i.e. F# sources. The list is not
+// sorted and is marked `# do not sort` so that buildifier doesn't sort it either.
+// Gazelle sorts every list of strings in srcs and deps when it writes a rule without looking for `# do not sort`, but
+// it leaves lists with other expressions alone: the strings are written as literals, which print exactly the same.
+func OrderedListWithComments(list []bzl.Expr, comments []bzl.Comment) *bzl.ListExpr {
+	expr := listWithComments(list, comments, false)
+	if expr == nil {
 		return nil
 	}
-	if len(comments) > 0 && len(list) == 0 {
-		// for some reason empty lists aren't written out, even if they have comments
-		// we'll have a comment for an error, so make sure the user actually sees something
-		list = append(list, &bzl.StringExpr{Value: ""})
+	for i, e := range expr.List {
+		if s, ok := e.(*bzl.StringExpr); ok {
+			expr.List[i] = &bzl.LiteralExpr{Token: bzl.FormatString(s), Comments: s.Comments}
+		}
+	}
+	if len(expr.List) > 1 {
+		commented := expr.List[0].Comment()
+		commented.Before = append([]bzl.Comment{{Token: "# do not sort"}}, commented.Before...)
 	}
-	expr := bzl.ListExpr{List: SortExprs(list)}
+	return expr
+}
+
+func listWithComments(list []bzl.Expr, comments []bzl.Comment, sorted bool) *bzl.ListExpr {
+	if len(list) == 0 {
+		return nil
+	}
+	if sorted {
+		list = SortExprs(list)
+	}
+	expr := bzl.ListExpr{List: list}
 	if len(comments) > 0 {
 		commented := list[0].Comment()
 		commented.Before = append(comments, commented.Before...)
 	}
 	return &expr
 }
+
+// CommentRule adds comments to the rule that have no element of a list to be placed on, i.e. the errors of an
+// attribute without values
+func CommentRule(r *rule.Rule, comments []bzl.Comment) {
+	for _, c := range comments {
+		r.AddComment(c.Token)
+	}
+}
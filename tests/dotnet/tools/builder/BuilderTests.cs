@@ -14,40 +14,38 @@ namespace BuilderTests
             var stream = new MemoryStream();
             var writer = new LaunchDataWriter(stream)
                 .Add("foo", "bar")
-                .Add("a", "b");
+                .Add("a", "b")
+                .AddList("args", new[] {"x", "y"});
 
             writer.Save();
 
-            stream.Seek(0, SeekOrigin.Begin);
-
-
-            var reader = new BinaryReader(stream);
-            var span = new ReadOnlySpan<byte>(reader.ReadBytes((int) reader.BaseStream.Length));
-
+            // the bytes that launchdata.Write of the go launcher writes for the same data
             var expectedLaunchBytes = new byte[]
             {
-                // https://unicodelookup.com/
-                0x66, // f
-                0x6F, // o
-                0x6F, // o
-                0x3D, // =
-                0x62, // b
-                0x61, // a
-                0x72, // r
-                0x00, // \0
-
-                0x61, // a
-                0x3D, // =
-                0x62, // b
-                0x00, // \0
+                0x4D, 0x53, 0x42, 0x4C, 0x44, 0x48, 0x44, 0x52, // MSBLDHDR
+                0x02, 0x00, // version
+                0x03, 0x00, 0x00, 0x00, // field count
+
+                0x00, // string
+                0x01, 0x00, 0x00, 0x00, 0x61, // a
+                0x01, 0x00, 0x00, 0x00, 0x62, // b
+
+                0x01, // list
+                0x04, 0x00, 0x00, 0x00, 0x61, 0x72, 0x67, 0x73, // args
+                0x02, 0x00, 0x00, 0x00, // count
+                0x01, 0x00, 0x00, 0x00, 0x78, // x
+                0x01, 0x00, 0x00, 0x00, 0x79, // y
+
+                0x00, // string
+                0x03, 0x00, 0x00, 0x00, 0x66, 0x6F, 0x6F, // foo
+                0x03, 0x00, 0x00, 0x00, 0x62, 0x61, 0x72, // bar
+
+                0x16, 0x03, 0xE6, 0x81, // crc32
+                0x43, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // length
+                0x4D, 0x53, 0x42, 0x4C, 0x44, 0x45, 0x4E, 0x44, // MSBLDEND
             };
 
-            var actualLaunchBytes = span.Slice(0, span.Length - sizeof(Int64)).ToArray();
-
-            actualLaunchBytes.Should().Equal(expectedLaunchBytes);
-
-            var launchDataLength = BitConverter.ToInt64(span.Slice(expectedLaunchBytes.Length).ToArray());
-            launchDataLength.Should().Be(span.Length - sizeof(Int64));
+            stream.ToArray().Should().Equal(expectedLaunchBytes);
         }
     }
-}
\ No newline at end of file
+}